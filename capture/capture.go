@@ -0,0 +1,120 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+// Package capture takes screenshots and screen recordings of the
+// display of the emulated machine.
+package capture
+
+import (
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/fzipp/oberon/risc"
+)
+
+// WritePNG writes the current content of the framebuffer to w as a PNG
+// image.
+func WritePNG(w io.Writer, fb *risc.Framebuffer) error {
+	return png.Encode(w, fb.Snapshot(fb.Rect))
+}
+
+// FileName returns a file name in dir for a capture taken at time t,
+// e.g. "oberon-20210312-154501.png" for the extension ".png".
+func FileName(dir string, t time.Time, ext string) string {
+	return filepath.Join(dir, "oberon-"+t.Format("20060102-150405")+ext)
+}
+
+// minFrameInterval is the shortest delay between two frames of a
+// recording. Browsers show GIF frames with a delay of less than
+// 20 milliseconds much slower than intended.
+const minFrameInterval = 20 * time.Millisecond
+
+// A Recorder records the display as an animated GIF. The first frame
+// is the complete screen, every following frame only contains the part
+// of the screen that changed. Changes that follow each other more
+// quickly than the GIF format can reproduce are combined into one
+// frame. The frames are kept in memory until the recording is written.
+type Recorder struct {
+	fb      *risc.Framebuffer
+	start   time.Time
+	last    time.Time       // time of the last frame
+	pending image.Rectangle // changed pixels since the last frame
+	elapsed int             // sum of the frame delays, in 100ths of a second
+	anim    gif.GIF
+}
+
+// NewRecorder starts a recording of the framebuffer at time t.
+func NewRecorder(fb *risc.Framebuffer, t time.Time) *Recorder {
+	rec := &Recorder{
+		fb:      fb,
+		start:   t,
+		pending: fb.Rect,
+	}
+	rec.anim.Config = image.Config{
+		Width:  fb.Rect.Dx(),
+		Height: fb.Rect.Dy(),
+	}
+	rec.addFrame(t)
+	return rec
+}
+
+// Update records the changes of the framebuffer at time t. The damage
+// rectangles are the ones returned by
+// risc.RISC.GetFramebufferDamageRectsAndReset.
+func (rec *Recorder) Update(damage []image.Rectangle, t time.Time) {
+	h := rec.fb.Rect.Dy()
+	// The recording keeps its size if the display is resized.
+	bounds := image.Rect(0, 0, rec.anim.Config.Width, rec.anim.Config.Height)
+	for _, d := range damage {
+		// Convert from words and lines, bottom-up, to pixels, top-down.
+		r := image.Rect(d.Min.X*32, h-1-d.Max.Y, (d.Max.X+1)*32, h-d.Min.Y)
+		rec.pending = rec.pending.Union(r.Intersect(bounds))
+	}
+	if rec.pending.Empty() || t.Sub(rec.last) < minFrameInterval {
+		return
+	}
+	rec.addFrame(t)
+}
+
+// Frames returns the number of frames recorded so far.
+func (rec *Recorder) Frames() int {
+	return len(rec.anim.Image)
+}
+
+// WriteGIF writes the recording up to time t to w as an animated GIF.
+// The recording can be continued afterwards.
+func (rec *Recorder) WriteGIF(w io.Writer, t time.Time) error {
+	if !rec.pending.Empty() {
+		rec.addFrame(t)
+	}
+	anim := rec.anim
+	anim.Delay = append([]int(nil), rec.anim.Delay...)
+	anim.Delay[len(anim.Delay)-1] = max(rec.centiseconds(t)-rec.elapsed, 1)
+	return gif.EncodeAll(w, &anim)
+}
+
+// addFrame adds the pending changes as a frame at time t and ends the
+// previous frame.
+func (rec *Recorder) addFrame(t time.Time) {
+	if n := len(rec.anim.Delay); n > 0 {
+		// The delays are truncated from the start of the recording,
+		// so that the rounding errors don't add up.
+		cs := rec.centiseconds(t)
+		rec.anim.Delay[n-1] = cs - rec.elapsed
+		rec.elapsed = cs
+	}
+	rec.anim.Image = append(rec.anim.Image, rec.fb.Snapshot(rec.pending))
+	rec.anim.Delay = append(rec.anim.Delay, 0)
+	rec.anim.Disposal = append(rec.anim.Disposal, gif.DisposalNone)
+	rec.last = t
+	rec.pending = image.Rectangle{}
+}
+
+func (rec *Recorder) centiseconds(t time.Time) int {
+	return int(t.Sub(rec.start) / (10 * time.Millisecond))
+}
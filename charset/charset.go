@@ -0,0 +1,182 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+// Package charset converts text between Oberon's character set and
+// UTF-8.
+//
+// Oberon's character set is ASCII, extended by the accented letters
+// used in German and French with the codes 0x80 to 0x95 and 0xAB (ß).
+// Oberon texts end lines with a carriage return (CR) and indent them
+// with tabs.
+package charset
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Replacement is the Oberon character that replaces a Unicode character
+// without a counterpart in Oberon's character set.
+const Replacement = '?'
+
+// extended are the Unicode characters of the Oberon characters 0x80
+// to 0x95.
+var extended = [...]rune{
+	'Ä', 'Ö', 'Ü',
+	'ä', 'ö', 'ü',
+	'â', 'ê', 'î', 'ô', 'û',
+	'à', 'è', 'ì', 'ò', 'ù',
+	'é', 'ë', 'ï', 'ç', 'á', 'ñ',
+}
+
+// sharpS is the Oberon character for 'ß'.
+const sharpS = 0xAB
+
+// Rune returns the Unicode character of an Oberon character, or
+// utf8.RuneError if there is none.
+func Rune(b byte) rune {
+	switch {
+	case b < 0x80:
+		return rune(b)
+	case int(b-0x80) < len(extended):
+		return extended[b-0x80]
+	case b == sharpS:
+		return 'ß'
+	}
+	return utf8.RuneError
+}
+
+// Byte returns the Oberon character of a Unicode character, or false if
+// there is none.
+func Byte(r rune) (byte, bool) {
+	switch {
+	case r < 0x80:
+		return byte(r), true
+	case r == 'ß':
+		return sharpS, true
+	}
+	for i, e := range extended {
+		if e == r {
+			return byte(0x80 + i), true
+		}
+	}
+	return 0, false
+}
+
+// Decode converts Oberon text to UTF-8. Line breaks (CR) become LF, tabs
+// are kept, and Oberon characters without a Unicode counterpart become
+// utf8.RuneError.
+func Decode(p []byte) string {
+	var b strings.Builder
+	for _, c := range p {
+		if c == '\r' {
+			b.WriteByte('\n')
+			continue
+		}
+		b.WriteRune(Rune(c))
+	}
+	return b.String()
+}
+
+// Encode converts UTF-8 text to Oberon's character set. Line breaks
+// (LF, CR LF or CR) become CR and tabs are kept. Characters outside of
+// Oberon's character set are replaced by similar characters if
+// possible: decomposed accents are combined with their letters, letters
+// with other accents lose them, and typographic quotes and dashes
+// become their ASCII counterparts. Other characters become Replacement.
+func Encode(s string) []byte {
+	s = strings.ReplaceAll(s, "\r\n", "\r")
+	s = strings.ReplaceAll(s, "\n", "\r")
+	p := make([]byte, 0, len(s))
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if i+1 < len(runes) && isCombining(runes[i+1]) {
+			if c, ok := composed[string(runes[i:i+2])]; ok {
+				r = c
+			}
+			i++
+			// Drop further accents of the same letter.
+			for i+1 < len(runes) && isCombining(runes[i+1]) {
+				i++
+			}
+		}
+		if c, ok := Byte(r); ok {
+			p = append(p, c)
+			continue
+		}
+		if isCombining(r) {
+			continue
+		}
+		if s, ok := similar[r]; ok {
+			p = append(p, s...)
+			continue
+		}
+		p = append(p, Replacement)
+	}
+	return p
+}
+
+// isCombining reports whether a character is a combining diacritical
+// mark, which puts an accent on the preceding letter.
+func isCombining(r rune) bool {
+	return r >= 0x0300 && r <= 0x036F
+}
+
+// composed maps the decomposed forms of the extended characters to
+// the characters.
+var composed = map[string]rune{}
+
+// combiningAccents maps combining diacritical marks to accents.
+var combiningAccents = map[rune]rune{
+	'\u0300': '`',
+	'\u0301': '´',
+	'\u0302': '^',
+	'\u0303': '~',
+	'\u0308': '¨',
+	'\u0327': '¸',
+}
+
+func init() {
+	for e, d := range accented {
+		for mark, accent := range combiningAccents {
+			if d.accent == accent {
+				composed[string([]rune{d.letter, mark})] = e
+			}
+		}
+	}
+}
+
+type decomposition struct {
+	letter, accent rune
+}
+
+// accented maps the extended characters to their letters and accents.
+var accented = map[rune]decomposition{
+	'Ä': {'A', '¨'}, 'Ö': {'O', '¨'}, 'Ü': {'U', '¨'},
+	'ä': {'a', '¨'}, 'ö': {'o', '¨'}, 'ü': {'u', '¨'},
+	'â': {'a', '^'}, 'ê': {'e', '^'}, 'î': {'i', '^'}, 'ô': {'o', '^'}, 'û': {'u', '^'},
+	'à': {'a', '`'}, 'è': {'e', '`'}, 'ì': {'i', '`'}, 'ò': {'o', '`'}, 'ù': {'u', '`'},
+	'é': {'e', '´'}, 'ë': {'e', '¨'}, 'ï': {'i', '¨'}, 'ç': {'c', '¸'}, 'á': {'a', '´'}, 'ñ': {'n', '~'},
+}
+
+// similar maps characters outside of Oberon's character set to
+// replacements.
+var similar = map[rune]string{
+	'‘': "'", '’': "'", '‚': "'", '‹': "'", '›': "'", '´': "'",
+	'“': `"`, '”': `"`, '„': `"`, '«': `"`, '»': `"`,
+	'–': "-", '—': "-", '‐': "-", '−': "-",
+	'…':      "...",
+	'\u00A0': " ",
+	'×':      "x",
+
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Å': "A", 'Æ': "AE",
+	'Ç': "C", 'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E",
+	'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I", 'Ñ': "N",
+	'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ø': "O", 'Œ': "OE",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ý': "Y",
+	'ã': "a", 'å': "a", 'æ': "ae",
+	'í': "i", 'ó': "o", 'õ': "o", 'ø': "o", 'œ': "oe",
+	'ú': "u", 'ý': "y", 'ÿ': "y",
+}
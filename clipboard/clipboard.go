@@ -0,0 +1,132 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+// Package clipboard implements the clipboard device of the emulator,
+// which exchanges text between the clipboard driver of Oberon and the
+// clipboard of the host.
+//
+// The device is independent of the host: a frontend passes it a Host
+// that gets and sets the text of its clipboard. This package provides
+// hosts for the clipboard commands of the operating system (Command)
+// and for a clipboard in memory (Memory). Frontends that learn about the
+// clipboard text of their host through change notifications, like a
+// browser, can keep it in a Memory clipboard.
+package clipboard
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/fzipp/oberon/charset"
+)
+
+// A Host is the clipboard of the host system.
+type Host interface {
+	// Text returns the text on the clipboard.
+	Text() (string, error)
+	// SetText puts a text on the clipboard.
+	SetText(text string) error
+}
+
+// A Device is the clipboard device of the machine. It implements the
+// risc.Clipboard interface: Oberon reads the length of the clipboard
+// text from the control register and then the text from the data
+// register, one character per read, or writes the length of a text to
+// the control register and then the text to the data register. The text
+// is converted between Oberon's character set and UTF-8, see the
+// charset package.
+type Device struct {
+	host     Host
+	errorLog io.Writer
+	state    state
+	data     []byte
+	dataLen  uint32
+}
+
+type state int
+
+const (
+	idle state = iota
+	get
+	put
+)
+
+// New returns a clipboard device for the clipboard of the host. Errors
+// of the host are written to the standard error output.
+func New(host Host) *Device {
+	return &Device{host: host, errorLog: os.Stderr}
+}
+
+// SetErrorLog sets the writer for the errors of the host.
+func (c *Device) SetErrorLog(w io.Writer) {
+	c.errorLog = w
+}
+
+func (c *Device) reset() {
+	c.state = idle
+	c.data = nil
+	c.dataLen = 0
+}
+
+func (c *Device) ReadControl() uint32 {
+	c.reset()
+	text, err := c.host.Text()
+	if err != nil {
+		_, _ = fmt.Fprintf(c.errorLog, "can't get clipboard text: %s\n", err)
+		return 0
+	}
+	c.data = charset.Encode(text)
+	if len(c.data) > math.MaxUint32 {
+		c.reset()
+		return 0
+	}
+	c.dataLen = uint32(len(c.data))
+	c.state = get
+	return c.dataLen
+}
+
+func (c *Device) WriteControl(length uint32) {
+	c.reset()
+	if length == 0 {
+		// No data follows.
+		c.putText()
+		return
+	}
+	c.state = put
+	c.dataLen = length
+}
+
+func (c *Device) ReadData() uint32 {
+	if c.state != get {
+		return 0
+	}
+	if len(c.data) == 0 {
+		c.reset()
+		return 0
+	}
+	result := uint32(c.data[0])
+	c.data = c.data[1:]
+	return result
+}
+
+func (c *Device) WriteData(value uint32) {
+	if c.state != put {
+		return
+	}
+	c.data = append(c.data, byte(value))
+	if len(c.data) == int(c.dataLen) {
+		c.putText()
+	}
+}
+
+// putText puts the written text on the clipboard of the host.
+func (c *Device) putText() {
+	err := c.host.SetText(charset.Decode(c.data))
+	if err != nil {
+		_, _ = fmt.Fprintf(c.errorLog, "can't set clipboard text: %s\n", err)
+	}
+	c.reset()
+}
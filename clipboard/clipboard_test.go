@@ -0,0 +1,134 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package clipboard_test
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fzipp/oberon/clipboard"
+)
+
+// readText reads the clipboard text through the device like the
+// clipboard driver of Oberon.
+func readText(d *clipboard.Device) []byte {
+	n := d.ReadControl()
+	var p []byte
+	for range n {
+		p = append(p, byte(d.ReadData()))
+	}
+	return p
+}
+
+// writeText writes a text through the device like the clipboard driver
+// of Oberon.
+func writeText(d *clipboard.Device, p []byte) {
+	d.WriteControl(uint32(len(p)))
+	for _, b := range p {
+		d.WriteData(uint32(b))
+	}
+}
+
+func TestDeviceGet(t *testing.T) {
+	tests := []struct {
+		text string
+		want []byte
+	}{
+		{"", nil},
+		{"Hello", []byte("Hello")},
+		{"Grüße\nau revoir\tà bientôt", []byte("Gr\x85\xABe\rau revoir\t\x8B bient\x89t")},
+		{"line\r\n", []byte("line\r")},
+		{"3 €", []byte("3 ?")},
+	}
+	for _, tt := range tests {
+		mem := clipboard.NewMemory(nil)
+		mem.Update(tt.text)
+		d := clipboard.New(mem)
+		if got := readText(d); !bytes.Equal(got, tt.want) {
+			t.Errorf("reading %q: got %q, want %q", tt.text, got, tt.want)
+		}
+		if got := d.ReadData(); got != 0 {
+			t.Errorf("reading %q: ReadData after the end = %d, want 0", tt.text, got)
+		}
+	}
+}
+
+func TestDevicePut(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte("Hello"), "Hello"},
+		{[]byte("Gr\x85\xABe\rau revoir\t\x8B bient\x89t"), "Grüße\nau revoir\tà bientôt"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		var notified []string
+		mem := clipboard.NewMemory(func(text string) {
+			notified = append(notified, text)
+		})
+		mem.Update("previous text")
+		d := clipboard.New(mem)
+		writeText(d, tt.data)
+		if got, _ := mem.Text(); got != tt.want {
+			t.Errorf("writing %q: clipboard text is %q, want %q", tt.data, got, tt.want)
+		}
+		if want := []string{tt.want}; !slices.Equal(notified, want) {
+			t.Errorf("writing %q: notified %q, want %q", tt.data, notified, want)
+		}
+	}
+}
+
+func TestDeviceInterruptedPut(t *testing.T) {
+	mem := clipboard.NewMemory(nil)
+	mem.Update("kept")
+	d := clipboard.New(mem)
+	d.WriteControl(10)
+	d.WriteData('a')
+	// A new transfer abandons the incomplete one.
+	if got := readText(d); string(got) != "kept" {
+		t.Errorf("got %q, want %q", got, "kept")
+	}
+	writeText(d, []byte("new"))
+	if got, _ := mem.Text(); got != "new" {
+		t.Errorf("clipboard text is %q, want %q", got, "new")
+	}
+}
+
+func TestDeviceReadDataWithoutControl(t *testing.T) {
+	mem := clipboard.NewMemory(nil)
+	mem.Update("text")
+	d := clipboard.New(mem)
+	if got := d.ReadData(); got != 0 {
+		t.Errorf("ReadData = %d, want 0", got)
+	}
+	d.WriteData('x')
+	if got, _ := mem.Text(); got != "text" {
+		t.Errorf("clipboard text is %q, want %q", got, "text")
+	}
+}
+
+type failingHost struct{}
+
+func (failingHost) Text() (string, error) { return "", errors.New("no clipboard") }
+func (failingHost) SetText(string) error  { return errors.New("no clipboard") }
+
+func TestDeviceHostErrors(t *testing.T) {
+	var log strings.Builder
+	d := clipboard.New(failingHost{})
+	d.SetErrorLog(&log)
+	if n := d.ReadControl(); n != 0 {
+		t.Errorf("ReadControl = %d, want 0", n)
+	}
+	writeText(d, []byte("text"))
+	want := "can't get clipboard text: no clipboard\n" +
+		"can't set clipboard text: no clipboard\n"
+	if got := log.String(); got != want {
+		t.Errorf("error log:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package clipboard
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Command is the clipboard of the host, accessed through commands such
+// as xclip on X11 or wl-copy and wl-paste on Wayland.
+type Command struct {
+	Get []string // command that writes the clipboard text to its output
+	Set []string // command that reads the clipboard text from its input
+}
+
+// commands are the known clipboard commands. The first one whose
+// programs are installed is used, if its display server is running.
+var commands = []struct {
+	env string // environment variable that must be set, if any
+	cmd Command
+}{
+	{"WAYLAND_DISPLAY", Command{
+		Get: []string{"wl-paste", "--no-newline"},
+		Set: []string{"wl-copy"},
+	}},
+	{"DISPLAY", Command{
+		Get: []string{"xclip", "-selection", "clipboard", "-out"},
+		Set: []string{"xclip", "-selection", "clipboard", "-in"},
+	}},
+	{"DISPLAY", Command{
+		Get: []string{"xsel", "--clipboard", "--output"},
+		Set: []string{"xsel", "--clipboard", "--input"},
+	}},
+	{"", Command{
+		Get: []string{"pbpaste"},
+		Set: []string{"pbcopy"},
+	}},
+}
+
+// ErrNoCommand is returned by FindCommand if no clipboard command is
+// available.
+var ErrNoCommand = errors.New("no clipboard command found (install wl-clipboard, xclip or xsel)")
+
+// FindCommand returns the clipboard commands of the host: wl-paste and
+// wl-copy on Wayland, xclip or xsel on X11, and pbpaste and pbcopy on
+// macOS.
+func FindCommand() (*Command, error) {
+	for _, c := range commands {
+		if c.env != "" && os.Getenv(c.env) == "" {
+			continue
+		}
+		if c.env == "" && runtime.GOOS != "darwin" {
+			continue
+		}
+		if installed(c.cmd.Get[0]) && installed(c.cmd.Set[0]) {
+			cmd := c.cmd
+			return &cmd, nil
+		}
+	}
+	return nil, ErrNoCommand
+}
+
+func installed(program string) bool {
+	_, err := exec.LookPath(program)
+	return err == nil
+}
+
+// Text runs the Get command and returns its output.
+func (c *Command) Text() (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(c.Get[0], c.Get[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", c.Get[0], err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", c.Get[0], err)
+	}
+	return string(out), nil
+}
+
+// SetText runs the Set command with the text as its input.
+func (c *Command) SetText(text string) error {
+	cmd := exec.Command(c.Set[0], c.Set[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	// The error output isn't captured: xclip and wl-copy stay in the
+	// background to serve the clipboard, and would keep it open.
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", c.Set[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package clipboard
+
+import "sync"
+
+// Memory is a clipboard in memory. It may be used from multiple
+// goroutines.
+type Memory struct {
+	mu     sync.Mutex
+	text   string
+	notify func(text string)
+}
+
+// NewMemory returns an empty clipboard in memory. If notify is not nil,
+// it is called with each text put on the clipboard by SetText.
+func NewMemory(notify func(text string)) *Memory {
+	return &Memory{notify: notify}
+}
+
+// Text returns the text on the clipboard.
+func (c *Memory) Text() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.text, nil
+}
+
+// SetText puts a text on the clipboard and notifies about it.
+func (c *Memory) SetText(text string) error {
+	c.Update(text)
+	if c.notify != nil {
+		c.notify(text)
+	}
+	return nil
+}
+
+// Update changes the text on the clipboard without notification, e.g.
+// when the host reports a change of its clipboard.
+func (c *Memory) Update(text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.text = text
+}
@@ -26,6 +26,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"unicode/utf8"
+
+	"github.com/fzipp/oberon/charset"
 )
 
 func usage() {
@@ -46,14 +49,6 @@ The converted plain text is written to the standard output.
 If the input is not an Oberon text it is written to the output unchanged.`)
 }
 
-var charMapping = [...]rune{
-	'Ä', 'Ö', 'Ü',
-	'ä', 'ö', 'ü',
-	'â', 'ê', 'î', 'ô', 'û',
-	'à', 'è', 'ì', 'ò', 'ù',
-	'é', 'ë', 'ï', 'ç', 'á', 'ñ',
-}
-
 func main() {
 	var err error
 
@@ -89,11 +84,10 @@ func main() {
 			_, err = out.Write([]byte("  "))
 		case b < 32:
 			continue
-		case 0x80 <= b && b <= 0x95:
-			_, err = out.WriteRune(charMapping[b-0x80])
-		case b == 0xAB:
-			_, err = out.WriteRune('ß')
+		case b >= 0x80 && charset.Rune(b) != utf8.RuneError:
+			_, err = out.WriteRune(charset.Rune(b))
 		default:
+			// Including the bytes above 0x7F that aren't Oberon characters
 			err = out.WriteByte(b)
 		}
 		check(err)
@@ -0,0 +1,69 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/fzipp/oberon/keybind"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// keyName returns the name of an SDL key in a key binding file.
+func keyName(sym sdl.Keycode) string {
+	switch sym {
+	case sdl.K_LCTRL:
+		return "LeftControl"
+	case sdl.K_RCTRL:
+		return "RightControl"
+	case sdl.K_LALT:
+		return "LeftAlt"
+	case sdl.K_RALT:
+		return "RightAlt"
+	case sdl.K_LSHIFT:
+		return "LeftShift"
+	case sdl.K_RSHIFT:
+		return "RightShift"
+	case sdl.K_LGUI:
+		return "LeftMeta"
+	case sdl.K_RGUI:
+		return "RightMeta"
+	}
+	return keybind.KeyName(sdl.GetKeyName(sym))
+}
+
+// keyModifiers returns the modifier keys of an SDL key event.
+func keyModifiers(mod uint16) keybind.Modifiers {
+	var mods keybind.Modifiers
+	if sdl.Keymod(mod)&sdl.KMOD_CTRL != 0 {
+		mods |= keybind.Ctrl
+	}
+	if sdl.Keymod(mod)&sdl.KMOD_ALT != 0 {
+		mods |= keybind.Alt
+	}
+	if sdl.Keymod(mod)&sdl.KMOD_SHIFT != 0 {
+		mods |= keybind.Shift
+	}
+	if sdl.Keymod(mod)&sdl.KMOD_GUI != 0 {
+		mods |= keybind.Meta
+	}
+	return mods
+}
+
+// typesCharacter reports whether a key is handled by its character in
+// character mode: SDL reports the characters typed by the keys in text
+// input events. Keys pressed with Ctrl type no character, unless Ctrl is
+// part of AltGr, and Shift and AltGr only select the character typed by
+// the next key.
+func typesCharacter(k sdl.Keysym) bool {
+	switch k.Sym {
+	case sdl.K_LSHIFT, sdl.K_RSHIFT, sdl.K_RALT, sdl.K_MODE:
+		return true
+	}
+	mod := sdl.Keymod(k.Mod)
+	if mod&sdl.KMOD_CTRL != 0 && mod&sdl.KMOD_RALT == 0 {
+		return false
+	}
+	return k.Sym >= ' ' && k.Sym != sdl.K_DELETE && k.Sym&sdl.K_SCANCODE_MASK == 0
+}
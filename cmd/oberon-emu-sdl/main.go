@@ -8,71 +8,41 @@ package main
 
 import (
 	"encoding/binary"
-	"errors"
 	"flag"
 	"fmt"
 	"image"
+	"image/color"
 	"log"
 	"math"
 	"os"
 	"unsafe"
 
+	"github.com/fzipp/oberon/clipboard"
+	"github.com/fzipp/oberon/emulator"
+	"github.com/fzipp/oberon/keybind"
+	"github.com/fzipp/oberon/ps2"
 	"github.com/fzipp/oberon/risc"
-	"github.com/fzipp/oberon/serial"
-	"github.com/fzipp/oberon/spi"
 
 	"github.com/veandco/go-sdl2/sdl"
 )
 
-const (
-	cpuHz = 25000000
-	fps   = 60
-)
-
-const (
-	colorBlack = 0x657b83
-	colorWhite = 0xfdf6e3
-)
-
 func main() {
 	opt, err := optionsFromFlags()
 	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	r := risc.New()
-	r.SetSerial(&serial.PCLink{})
-	r.SetClipboard(&SDLClipboard{})
-
-	if opt.leds {
-		r.SetLEDs(&ConsoleLEDs{})
-	}
-
-	if opt.bootFromSerial {
-		r.SetSwitches(1)
-	}
-
-	if opt.mem > 0 || opt.size != "" {
-		r.ConfigureMemory(opt.mem, opt.sizeRect.Dx(), opt.sizeRect.Dy())
-	}
-
-	disk, err := spi.NewDisk(opt.diskImageFile)
+	c := opt.machine
+	c.Clipboard = clipboard.New(sdlClipboard{})
+	m, err := emulator.New(c)
 	check(err)
-	r.SetSPI(1, disk)
-
-	if opt.serialIn != "" || opt.serialOut != "" {
-		raw, err := serial.Open(opt.serialIn, opt.serialOut)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "can't open serial I/O: %s", err)
-			return
-		}
-		r.SetSerial(raw)
-	}
 
+	fb := m.Framebuffer()
 	riscRect := sdl.Rect{
-		W: int32(opt.sizeRect.Dx()),
-		H: int32(opt.sizeRect.Dy()),
+		W: int32(fb.Rect.Dx()),
+		H: int32(fb.Rect.Dy()),
 	}
 
 	if err := sdl.Init(sdl.INIT_VIDEO); err != nil {
@@ -85,6 +55,9 @@ func main() {
 	sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "best")
 
 	windowFlags := sdl.WINDOW_HIDDEN
+	if c.Resizable {
+		windowFlags |= sdl.WINDOW_RESIZABLE
+	}
 	display := 0
 	if opt.fullscreen {
 		windowFlags |= sdl.WINDOW_FULLSCREEN_DESKTOP
@@ -117,119 +90,251 @@ func main() {
 	)
 	check(err)
 
-	fb := r.Framebuffer()
-	displayRect, displayScale := scaleDisplay(window, riscRect)
-	err = updateTexture(fb, r.GetFramebufferDamageAndReset(), texture, riscRect)
-	check(err)
+	f := &frontend{
+		window:     window,
+		renderer:   renderer,
+		texture:    texture,
+		riscRect:   riscRect,
+		screen:     newScreenCapture(fb, opt.captureDir),
+		keys:       keybind.NewKeyboard(opt.keys),
+		layout:     opt.layout,
+		fullscreen: opt.fullscreen,
+		zoom:       opt.zoom,
+		resize:     c.Resizable,
+		showLEDs:   opt.showLEDs,
+	}
+	if opt.layout != nil {
+		sdl.StartTextInput()
+	} else {
+		sdl.StopTextInput()
+	}
+	if opt.record != "" {
+		f.screen.startRecording(opt.record)
+	}
+	f.displayRect, f.displayScale = scaleDisplay(window, riscRect)
+	f.Display(fb, m.RISC().GetFramebufferDamageRectsAndReset())
 	window.Show()
-	err = renderer.Clear()
-	check(err)
-	err = renderer.Copy(texture, &riscRect, &displayRect)
-	check(err)
-	renderer.Present()
 
-	done := false
-	mouseWasOffscreen := false
-	for !done {
-		frameStart := sdl.GetTicks64()
+	emulator.Run(m, f)
 
-		for {
-			event := sdl.PollEvent()
-			if event == nil {
-				break
-			}
-			switch event.GetType() {
-			case sdl.QUIT:
-				done = true
-
-			case sdl.WINDOWEVENT:
-				ev := event.(*sdl.WindowEvent)
-				if ev.Event == sdl.WINDOWEVENT_RESIZED {
-					displayRect, displayScale = scaleDisplay(window, riscRect)
+	f.screen.stopRecording()
+	check(m.Close())
+}
+
+// A frontend shows the display of the machine in an SDL window.
+type frontend struct {
+	window   *sdl.Window
+	renderer *sdl.Renderer
+	texture  *sdl.Texture
+	riscRect sdl.Rect // framebuffer size
+
+	displayRect  sdl.Rect // framebuffer area in the window
+	displayScale float64
+
+	screen     *screenCapture
+	keys       *keybind.Keyboard
+	layout     *ps2.Layout // keyboard layout in character mode, or nil
+	fullscreen bool
+	zoom       float64
+	resize     bool
+	showLEDs   bool
+	leds       uint8 // LED state after the last frame
+
+	mouseWasOffscreen bool
+}
+
+func (f *frontend) Input(m *emulator.Machine) bool {
+	f.leds = m.LEDs()
+	for {
+		event := sdl.PollEvent()
+		if event == nil {
+			return true
+		}
+		switch event.GetType() {
+		case sdl.QUIT:
+			return false
+
+		case sdl.WINDOWEVENT:
+			ev := event.(*sdl.WindowEvent)
+			if ev.Event == sdl.WINDOWEVENT_RESIZED {
+				if f.resize {
+					f.resizeDisplay(m)
 				}
+				f.displayRect, f.displayScale = scaleDisplay(f.window, f.riscRect)
+			}
 
-			case sdl.MOUSEMOTION:
-				ev := event.(*sdl.MouseMotionEvent)
-				scaledX := int(math.Round(float64(ev.X-displayRect.X) / displayScale))
-				scaledY := int(math.Round(float64(ev.Y-displayRect.Y) / displayScale))
-				x := clamp(scaledX, 0, int(riscRect.W)-1)
-				y := clamp(scaledY, 0, int(riscRect.H)-1)
-				mouseIsOffscreen := x != scaledX || y != scaledY
-				if mouseIsOffscreen != mouseWasOffscreen {
-					var toggle int
-					if mouseIsOffscreen {
-						toggle = sdl.ENABLE
-					} else {
-						toggle = sdl.DISABLE
-					}
-					_, err = sdl.ShowCursor(toggle)
-					check(err)
-					mouseWasOffscreen = mouseIsOffscreen
+		case sdl.MOUSEMOTION:
+			ev := event.(*sdl.MouseMotionEvent)
+			scaledX := int(math.Round(float64(ev.X-f.displayRect.X) / f.displayScale))
+			scaledY := int(math.Round(float64(ev.Y-f.displayRect.Y) / f.displayScale))
+			x := clamp(scaledX, 0, int(f.riscRect.W)-1)
+			y := clamp(scaledY, 0, int(f.riscRect.H)-1)
+			mouseIsOffscreen := x != scaledX || y != scaledY
+			if mouseIsOffscreen != f.mouseWasOffscreen {
+				var toggle int
+				if mouseIsOffscreen {
+					toggle = sdl.ENABLE
+				} else {
+					toggle = sdl.DISABLE
+				}
+				_, err := sdl.ShowCursor(toggle)
+				check(err)
+				f.mouseWasOffscreen = mouseIsOffscreen
+			}
+			m.MouseMoved(x, int(f.riscRect.H)-y-1)
+
+		case sdl.MOUSEBUTTONDOWN, sdl.MOUSEBUTTONUP:
+			ev := event.(*sdl.MouseButtonEvent)
+			down := ev.State == sdl.PRESSED
+			m.MouseButton(int(ev.Button), down)
+
+		case sdl.MOUSEWHEEL:
+			ev := event.(*sdl.MouseWheelEvent)
+			steps := -int(ev.Y)
+			if ev.Direction == sdl.MOUSEWHEEL_FLIPPED {
+				steps = -steps
+			}
+			m.MouseWheel(steps)
+
+		case sdl.KEYDOWN:
+			ev := event.(*sdl.KeyboardEvent)
+			action := f.keys.Press(keyName(ev.Keysym.Sym), keyModifiers(ev.Keysym.Mod))
+			switch action {
+			case keybind.None:
+				if f.layout == nil || !typesCharacter(ev.Keysym) {
+					m.KeyboardInput(ps2Encode(ev.Keysym.Scancode, true))
 				}
-				r.MouseMoved(x, int(riscRect.H)-y-1)
-
-			case sdl.MOUSEBUTTONDOWN, sdl.MOUSEBUTTONUP:
-				ev := event.(*sdl.MouseButtonEvent)
-				down := ev.State == sdl.PRESSED
-				r.MouseButton(int(ev.Button), down)
-
-			case sdl.KEYDOWN, sdl.KEYUP:
-				ev := event.(*sdl.KeyboardEvent)
-				down := ev.State == sdl.PRESSED
-				switch mapKeyboardEvent(ev) {
-				case actionReset:
-					r.Reset()
-				case actionToggleFullscreen:
-					opt.fullscreen = !opt.fullscreen
-					if opt.fullscreen {
-						err = window.SetFullscreen(sdl.WINDOW_FULLSCREEN_DESKTOP)
-					} else {
-						err = window.SetFullscreen(0)
-					}
-					check(err)
-				case actionQuit:
-					_, err = sdl.PushEvent(&sdl.QuitEvent{
-						Type:      sdl.QUIT,
-						Timestamp: uint32(sdl.GetTicks64()),
-					})
-					check(err)
-				case actionFakeMouse1:
-					r.MouseButton(1, down)
-				case actionFakeMouse2:
-					r.MouseButton(2, down)
-				case actionFakeMouse3:
-					r.MouseButton(3, down)
-				case actionOberonInput:
-					r.KeyboardInput(ps2Encode(ev.Keysym.Scancode, down))
+			case keybind.Reset:
+				m.Reset()
+			case keybind.Fullscreen:
+				f.fullscreen = !f.fullscreen
+				var err error
+				if f.fullscreen {
+					err = f.window.SetFullscreen(sdl.WINDOW_FULLSCREEN_DESKTOP)
+				} else {
+					err = f.window.SetFullscreen(0)
+				}
+				check(err)
+			case keybind.Screenshot:
+				f.screen.screenshot()
+			case keybind.Record:
+				f.screen.toggleRecording()
+			case keybind.Paste:
+				if m.Typing() {
+					m.StopTyping()
+					break
+				}
+				text, err := sdl.GetClipboardText()
+				if err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "can't get clipboard text: %s\n", err)
 				}
+				m.Type(text, f.layout)
+			case keybind.Quit:
+				_, err := sdl.PushEvent(&sdl.QuitEvent{
+					Type:      sdl.QUIT,
+					Timestamp: uint32(sdl.GetTicks64()),
+				})
+				check(err)
+			case keybind.Mouse1, keybind.Mouse2, keybind.Mouse3:
+				m.MouseButton(action.MouseButton(), true)
 			}
-		}
 
-		r.SetTime(uint32(frameStart))
-		err = r.Run(cpuHz / fps)
-		if err != nil {
-			var riscErr *risc.Error
-			if errors.As(err, &riscErr) {
-				_, _ = fmt.Fprintf(os.Stderr, "%s (PC=0x%08X)\n", riscErr, riscErr.PC)
-			} else {
-				_, _ = fmt.Fprintln(os.Stderr, err)
+		case sdl.KEYUP:
+			ev := event.(*sdl.KeyboardEvent)
+			action := f.keys.Release(keyName(ev.Keysym.Sym))
+			if action == keybind.None {
+				if f.layout == nil || !typesCharacter(ev.Keysym) {
+					m.KeyboardInput(ps2Encode(ev.Keysym.Scancode, false))
+				}
+			} else if button := action.MouseButton(); button != 0 {
+				m.MouseButton(button, false)
+			}
+
+		case sdl.TEXTINPUT:
+			if f.layout == nil {
+				break
+			}
+			ev := event.(*sdl.TextInputEvent)
+			for _, r := range ev.GetText() {
+				if out, ok := f.layout.Encode(r); ok {
+					m.KeyboardInput(out)
+				}
 			}
 		}
+	}
+}
 
-		err = updateTexture(fb, r.GetFramebufferDamageAndReset(), texture, riscRect)
-		check(err)
-		err = renderer.Clear()
-		check(err)
-		err = renderer.Copy(texture, &riscRect, &displayRect)
-		check(err)
-		renderer.Present()
+func (f *frontend) Display(fb *risc.Framebuffer, damage []image.Rectangle) {
+	if fb.Rect.Dx() != int(f.riscRect.W) || fb.Rect.Dy() != int(f.riscRect.H) {
+		f.resizeTexture(fb.Rect)
+	}
+	f.screen.update(damage)
+	err := updateTexture(fb, damage, f.texture, f.riscRect)
+	check(err)
+	err = f.renderer.Clear()
+	check(err)
+	err = f.renderer.Copy(f.texture, &f.riscRect, &f.displayRect)
+	check(err)
+	if f.showLEDs {
+		f.drawLEDs()
+	}
+	f.renderer.Present()
+}
 
-		frameEnd := sdl.GetTicks64()
-		delay := int(frameStart) + 1000/fps - int(frameEnd)
-		if delay > 0 {
-			sdl.Delay(uint32(delay))
+// drawLEDs draws the LEDs in the bottom right corner of the window,
+// from LED 7 on the left to LED 0 on the right.
+func (f *frontend) drawLEDs() {
+	const size, gap, margin = 8, 4, 8
+	winW, winH := f.window.GetSize()
+	x := winW - margin - 8*size - 7*gap
+	y := winH - margin - size
+	for i := 7; i >= 0; i-- {
+		if f.leds&(1<<i) != 0 {
+			check(f.renderer.SetDrawColor(0xff, 0x30, 0x30, 0xff))
+		} else {
+			check(f.renderer.SetDrawColor(0x40, 0x10, 0x10, 0xff))
 		}
+		check(f.renderer.FillRect(&sdl.Rect{X: x, Y: y, W: size, H: size}))
+		x += size + gap
+	}
+	// Clear uses the draw color.
+	check(f.renderer.SetDrawColor(0, 0, 0, 0xff))
+}
+
+// resizeDisplay resizes the framebuffer to fill the window at the zoom
+// factor, or at the original scale in fullscreen mode.
+func (f *frontend) resizeDisplay(m *emulator.Machine) {
+	zoom := f.zoom
+	if f.fullscreen {
+		zoom = 1
+	}
+	winW, winH := f.window.GetSize()
+	w := clamp(int(float64(winW)/zoom), 32, emulator.MaxScreenWidth) &^ 31
+	h := clamp(int(float64(winH)/zoom), 32, emulator.MaxScreenHeight)
+	if w == int(f.riscRect.W) && h == int(f.riscRect.H) {
+		return
+	}
+	if err := m.ResizeDisplay(w, h); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return
 	}
+	f.resizeTexture(m.Framebuffer().Rect)
+}
+
+// resizeTexture replaces the texture with one of the new framebuffer
+// size.
+func (f *frontend) resizeTexture(size image.Rectangle) {
+	f.riscRect = sdl.Rect{W: int32(size.Dx()), H: int32(size.Dy())}
+	texture, err := f.renderer.CreateTexture(
+		sdl.PIXELFORMAT_ARGB8888,
+		sdl.TEXTUREACCESS_STREAMING,
+		f.riscRect.W,
+		f.riscRect.H,
+	)
+	check(err)
+	check(f.texture.Destroy())
+	f.texture = texture
+	f.displayRect, f.displayScale = scaleDisplay(f.window, f.riscRect)
 }
 
 func scaleDisplay(window *sdl.Window, riscRect sdl.Rect) (sdl.Rect, float64) {
@@ -256,14 +361,26 @@ func scaleDisplay(window *sdl.Window, riscRect sdl.Rect) (sdl.Rect, float64) {
 
 // Only used in update_texture(), but some systems complain if you
 // allocate three megabyte on the stack.
-var pixelBuf [maxWidth * maxHeight * 4]byte
+var pixelBuf [emulator.MaxScreenWidth * emulator.MaxScreenHeight * 4]byte
+
+func updateTexture(fb *risc.Framebuffer, damage []image.Rectangle, texture *sdl.Texture, riscRect sdl.Rect) error {
+	for _, d := range damage {
+		err := updateTextureRect(fb, d, texture, riscRect)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-func updateTexture(fb *risc.Framebuffer, damage image.Rectangle, texture *sdl.Texture, riscRect sdl.Rect) error {
+func updateTextureRect(fb *risc.Framebuffer, damage image.Rectangle, texture *sdl.Texture, riscRect sdl.Rect) error {
 	if damage.Min.Y > damage.Max.Y {
 		return nil
 	}
 
 	var outIdx uint32
+	black := argbValue(fb.Palette.Black)
+	white := argbValue(fb.Palette.White)
 
 	for line := damage.Max.Y; line >= damage.Min.Y; line-- {
 		lineStart := line * (int(riscRect.W) / 32)
@@ -272,9 +389,9 @@ func updateTexture(fb *risc.Framebuffer, damage image.Rectangle, texture *sdl.Te
 			for range 32 {
 				var color uint32
 				if pixels&1 > 0 {
-					color = colorWhite
+					color = white
 				} else {
-					color = colorBlack
+					color = black
 				}
 				binary.LittleEndian.PutUint32(pixelBuf[outIdx*4:], color)
 				pixels >>= 1
@@ -292,6 +409,11 @@ func updateTexture(fb *risc.Framebuffer, damage image.Rectangle, texture *sdl.Te
 	return texture.Update(&rect, unsafe.Pointer(&pixelBuf), int(rect.W)*4)
 }
 
+// argbValue packs a color as 0xAARRGGBB, the texture pixel format.
+func argbValue(c color.RGBA) uint32 {
+	return uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+}
+
 func bestDisplay(rect sdl.Rect) (int, error) {
 	best := 0
 	displayCnt, err := sdl.GetNumVideoDisplays()
@@ -323,3 +445,13 @@ func fail(message any) {
 	_, _ = fmt.Fprintln(os.Stderr, message)
 	os.Exit(1)
 }
+
+func clamp(x, min, max int) int {
+	if x < min {
+		return min
+	}
+	if x > max {
+		return max
+	}
+	return x
+}
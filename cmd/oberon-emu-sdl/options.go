@@ -5,86 +5,63 @@
 package main
 
 import (
-	"errors"
 	"flag"
-	"fmt"
-	"image"
 
-	"github.com/fzipp/oberon/risc"
-)
-
-const (
-	maxHeight = 2048
-	maxWidth  = 2048
+	"github.com/fzipp/oberon/emulator"
+	"github.com/fzipp/oberon/keybind"
+	"github.com/fzipp/oberon/ps2"
 )
 
 type options struct {
-	fullscreen     bool
-	zoom           float64
-	leds           bool
-	mem            int
-	size           string
-	sizeRect       image.Rectangle
-	bootFromSerial bool
-	serialIn       string
-	serialOut      string
-	diskImageFile  string
+	machine    emulator.Config
+	keys       *keybind.Bindings
+	layout     *ps2.Layout
+	fullscreen bool
+	zoom       float64
+	showLEDs   bool
+	captureDir string
+	record     string
 }
 
 func optionsFromFlags() (*options, error) {
+	var machine emulator.Config
+	machine.RegisterFlags(flag.CommandLine)
 	fullscreen := flag.Bool("fullscreen", false, "Start the emulator in full screen mode")
 	zoom := flag.Float64("zoom", 0, "Scale the display in windowed mode by the given factor")
-	leds := flag.Bool("leds", false, "Log LED state on stdout")
-	mem := flag.Int("mem", 0, "Set memory size in `MEGS`")
-	size := flag.String("size", "", "Set framebuffer size to `WIDTHxHEIGHT`")
-	bootFromSerial := flag.Bool("boot-from-serial", false, "Boot from serial line (disk image not required)")
-	serialIn := flag.String("serial-in", "", "Read serial input from `FILE`")
-	serialOut := flag.String("serial-out", "", "Read serial input from `FILE`")
+	flag.BoolVar(&machine.Resizable, "resize", false, "Resize the Oberon display with the window (requires a display driver that supports it)")
+	showLEDs := flag.Bool("show-leds", false, "Show the LEDs of the machine in the corner of the window")
+	captureDir := flag.String("capture-dir", ".", "Save screenshots and recordings in `DIR`")
+	record := flag.String("record", "", "Record the screen from the start as an animated GIF to `FILE`")
+	keysFile := flag.String("keys", keybind.DefaultFile(), "Read the key bindings from `FILE`")
+	layoutName := flag.String("layout", "", "Pass the typed characters instead of the key positions, with the keyboard layout `NAME` of the Oberon keyboard driver: us, de or ch")
 
 	flag.Parse()
 
-	diskImageFile := ""
-	if !*bootFromSerial {
-		if flag.NArg() < 1 {
-			return nil, errors.New("missing argument")
-		}
-		diskImageFile = flag.Arg(0)
+	if err := machine.SetArgs(flag.Args()); err != nil {
+		return nil, err
 	}
 
-	sizeRect := image.Rect(0, 0, risc.FramebufferWidth, risc.FramebufferHeight)
+	keys, err := keybind.Load(*keysFile)
+	if err != nil {
+		return nil, err
+	}
 
-	if *size != "" {
-		var w, h int
-		_, err := fmt.Sscanf(*size, "%dx%d", &w, &h)
+	var layout *ps2.Layout
+	if *layoutName != "" {
+		layout, err = ps2.LayoutByName(*layoutName)
 		if err != nil {
-			return nil, errors.New("invalid size")
+			return nil, err
 		}
-		sizeRect = image.Rect(0, 0,
-			clamp(w, 32, maxWidth)&^31,
-			clamp(h, 32, maxHeight),
-		)
 	}
 
 	return &options{
-		fullscreen:     *fullscreen,
-		zoom:           *zoom,
-		leds:           *leds,
-		mem:            *mem,
-		size:           *size,
-		sizeRect:       sizeRect,
-		bootFromSerial: *bootFromSerial,
-		serialIn:       *serialIn,
-		serialOut:      *serialOut,
-		diskImageFile:  diskImageFile,
+		machine:    machine,
+		keys:       keys,
+		layout:     layout,
+		fullscreen: *fullscreen,
+		zoom:       *zoom,
+		showLEDs:   *showLEDs,
+		captureDir: *captureDir,
+		record:     *record,
 	}, nil
 }
-
-func clamp(x, min, max int) int {
-	if x < min {
-		return min
-	}
-	if x > max {
-		return max
-	}
-	return x
-}
@@ -0,0 +1,10 @@
+module github.com/fzipp/oberon/cmd/oberon-emu-term
+
+go 1.22.0
+
+require (
+	github.com/fzipp/oberon v0.3.0
+	golang.org/x/term v0.20.0
+)
+
+require golang.org/x/sys v0.20.0 // indirect
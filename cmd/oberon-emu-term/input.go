@@ -0,0 +1,221 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Terminal modes for xterm mouse reporting: report all motion events
+// and encode them in the SGR format, which has no coordinate limit.
+const (
+	enableMouse  = "\x1b[?1003h\x1b[?1006h"
+	disableMouse = "\x1b[?1006l\x1b[?1003l"
+)
+
+const keyCtrlC = 0x03
+
+type event any
+
+// A keyEvent is a key press, identified by its X11 keysym. Typed
+// characters have the keysyms of Unicode characters. Terminals don't
+// report key releases.
+type keyEvent struct {
+	keysym uint32
+}
+
+// A mouseEvent is a mouse button change or a mouse movement at a
+// character cell, counted from 0 at the top left.
+type mouseEvent struct {
+	button int // 1 = left, 2 = middle, 3 = right, 0 = none
+	down   bool
+	col    int
+	row    int
+}
+
+type quitEvent struct{}
+
+// parseInput decodes the keyboard and mouse events from the terminal
+// input, which is encoded in UTF-8. An incomplete escape sequence or
+// character at the end of the input is returned as rest, to be
+// completed by the next input.
+func parseInput(p []byte) (events []event, rest []byte) {
+	for len(p) > 0 {
+		b := p[0]
+		if b >= utf8.RuneSelf {
+			if !utf8.FullRune(p) {
+				return events, p
+			}
+			r, n := utf8.DecodeRune(p)
+			p = p[n:]
+			if r != utf8.RuneError {
+				events = append(events, keyEvent{runeKeysym(r)})
+			}
+			continue
+		}
+		if b != 0x1b {
+			p = p[1:]
+			switch {
+			case b == keyCtrlC:
+				events = append(events, quitEvent{})
+			case b == '\r' || b == '\n':
+				events = append(events, keyEvent{xkReturn})
+			case b == '\t':
+				events = append(events, keyEvent{xkTab})
+			case b == 0x7f || b == 0x08:
+				events = append(events, keyEvent{xkBackSpace})
+			case 0x20 <= b && b < 0x7f:
+				events = append(events, keyEvent{uint32(b)})
+			}
+			continue
+		}
+		ev, n := parseEscape(p)
+		if n == 0 {
+			return events, p
+		}
+		if ev != nil {
+			events = append(events, ev)
+		}
+		p = p[n:]
+	}
+	return events, nil
+}
+
+// parseEscape decodes the escape sequence at the start of p. It returns
+// the number of bytes consumed, which is 0 if the sequence is incomplete.
+// Unknown sequences are consumed without an event.
+func parseEscape(p []byte) (event, int) {
+	if len(p) < 2 {
+		return nil, 0
+	}
+	switch p[1] {
+	case 'O':
+		// SS3 sequences: F1 to F4
+		if len(p) < 3 {
+			return nil, 0
+		}
+		if 'P' <= p[2] && p[2] <= 'S' {
+			return keyEvent{xkF1 + uint32(p[2]-'P')}, 3
+		}
+		return nil, 3
+	case '[':
+		// CSI sequences: parameter bytes, then a final byte
+		end := 2
+		for end < len(p) && (p[end] < 0x40 || p[end] > 0x7e) {
+			end++
+		}
+		if end == len(p) {
+			return nil, 0
+		}
+		return parseCSI(p[2:end], p[end]), end + 1
+	case 0x1b:
+		// Escape pressed twice
+		return keyEvent{xkEscape}, 1
+	}
+	// Alt+key: ignore the Alt modifier and forward the key
+	return nil, 1
+}
+
+func parseCSI(params []byte, final byte) event {
+	if len(params) > 0 && params[0] == '<' && (final == 'M' || final == 'm') {
+		return parseSGRMouse(params[1:], final == 'M')
+	}
+	switch final {
+	case 'A':
+		return keyEvent{xkUp}
+	case 'B':
+		return keyEvent{xkDown}
+	case 'C':
+		return keyEvent{xkRight}
+	case 'D':
+		return keyEvent{xkLeft}
+	case 'H':
+		return keyEvent{xkHome}
+	case 'F':
+		return keyEvent{xkEnd}
+	case '~':
+		n, _ := strconv.Atoi(string(params))
+		if keysym, ok := tildeKeys[n]; ok {
+			return keyEvent{keysym}
+		}
+	}
+	return nil
+}
+
+// tildeKeys maps the parameters of "ESC [ n ~" sequences to keysyms.
+var tildeKeys = map[int]uint32{
+	1:  xkHome,
+	2:  xkInsert,
+	3:  xkDelete,
+	4:  xkEnd,
+	5:  xkPageUp,
+	6:  xkPageDown,
+	11: xkF1,
+	12: xkF1 + 1,
+	13: xkF1 + 2,
+	14: xkF1 + 3,
+	15: xkF1 + 4,
+	17: xkF1 + 5,
+	18: xkF1 + 6,
+	19: xkF1 + 7,
+	20: xkF1 + 8,
+	21: xkF1 + 9,
+	23: xkF1 + 10,
+	24: xkF1 + 11,
+}
+
+// parseSGRMouse decodes the parameters "Cb;Cx;Cy" of an SGR mouse report.
+func parseSGRMouse(params []byte, press bool) event {
+	fields := bytes.Split(params, []byte{';'})
+	if len(fields) != 3 {
+		return nil
+	}
+	cb, err1 := strconv.Atoi(string(fields[0]))
+	cx, err2 := strconv.Atoi(string(fields[1]))
+	cy, err3 := strconv.Atoi(string(fields[2]))
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil
+	}
+	if cb&64 != 0 {
+		// Wheel events
+		return nil
+	}
+	ev := mouseEvent{col: cx - 1, row: cy - 1}
+	if cb&32 == 0 {
+		// Button press or release, not a motion
+		ev.button = cb&3 + 1
+		ev.down = press
+	}
+	return ev
+}
+
+// runeKeysym returns the keysym of a character, see ps2.KeysymRune.
+func runeKeysym(r rune) uint32 {
+	if r <= 0xFF {
+		return uint32(r)
+	}
+	return 0x01000000 + uint32(r)
+}
+
+// X11 keysyms of the non-character keys
+const (
+	xkBackSpace = 0xFF08
+	xkTab       = 0xFF09
+	xkReturn    = 0xFF0D
+	xkEscape    = 0xFF1B
+	xkHome      = 0xFF50
+	xkLeft      = 0xFF51
+	xkUp        = 0xFF52
+	xkRight     = 0xFF53
+	xkDown      = 0xFF54
+	xkPageUp    = 0xFF55
+	xkPageDown  = 0xFF56
+	xkEnd       = 0xFF57
+	xkInsert    = 0xFF63
+	xkF1        = 0xFFBE
+	xkDelete    = 0xFFFF
+)
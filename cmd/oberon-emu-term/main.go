@@ -0,0 +1,207 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+// Command oberon-emu-term is an emulator for the Project Oberon RISC machine.
+// It renders the screen in a terminal with Unicode Braille patterns or
+// block characters.
+//
+// The mouse is supported in terminals with xterm mouse reporting.
+// Press Ctrl-C to quit.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fzipp/oberon/clipboard"
+	"github.com/fzipp/oberon/emulator"
+	"github.com/fzipp/oberon/ps2"
+	"github.com/fzipp/oberon/risc"
+
+	"golang.org/x/term"
+)
+
+// fps is the frame rate. A terminal can't show more frames per second.
+const fps = 30
+
+// Escape sequences to switch to the alternate screen with a hidden
+// cursor and back.
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l" + enableMouse
+	leaveScreen = disableMouse + "\x1b[0m\x1b[?25h\x1b[?1049l"
+)
+
+func main() {
+	opt, err := optionsFromFlags()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fail("standard input is not a terminal")
+	}
+	err = run(opt)
+	check(err)
+}
+
+// run executes the machine on the terminal until Ctrl-C is pressed.
+// It returns the last error of the machine, if any.
+func run(opt *options) error {
+	// The errors can't be shown while the machine occupies the screen.
+	errorLog := &lastError{}
+	c := opt.machine
+	c.FrameRate = fps
+	c.ErrorLog = errorLog
+	if host, err := clipboard.FindCommand(); err == nil {
+		dev := clipboard.New(host)
+		dev.SetErrorLog(errorLog)
+		c.Clipboard = dev
+	}
+	m, err := emulator.New(c)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	out := bufio.NewWriter(os.Stdout)
+	_, _ = out.WriteString(enterScreen)
+	defer func() {
+		_, _ = out.WriteString(leaveScreen)
+		_ = out.Flush()
+	}()
+
+	input := make(chan []byte)
+	go readInput(os.Stdin, input)
+
+	fb := m.Framebuffer()
+	glyphs := braille
+	if opt.blocks {
+		glyphs = blocks
+	}
+	t := &terminal{
+		fd:     fd,
+		out:    out,
+		input:  input,
+		screen: newScreen(fb, glyphs, opt.invert, opt.machine.Palette),
+		scale:  opt.scale,
+		layout: opt.layout,
+	}
+	emulator.Run(m, t)
+	return errorLog.err
+}
+
+// A terminal shows the display of the machine on the terminal and
+// forwards the keys and mouse events read from standard input.
+type terminal struct {
+	fd     int
+	out    *bufio.Writer
+	input  <-chan []byte
+	screen *screen
+	scale  int
+	layout *ps2.Layout
+
+	pending            []byte // incomplete input sequence
+	termCols, termRows int
+}
+
+func (t *terminal) Input(m *emulator.Machine) bool {
+	received := false
+drain:
+	for {
+		select {
+		case p, ok := <-t.input:
+			if !ok {
+				return false
+			}
+			t.pending = append(t.pending, p...)
+			received = true
+		default:
+			break drain
+		}
+	}
+	events, rest := parseInput(t.pending)
+	if !received && len(rest) == 1 && rest[0] == 0x1b {
+		// A lone Escape that is not followed by the rest of a sequence
+		events = append(events, keyEvent{xkEscape})
+		rest = nil
+	}
+	t.pending = append(t.pending[:0], rest...)
+	for _, ev := range events {
+		switch ev := ev.(type) {
+		case quitEvent:
+			return false
+		case keyEvent:
+			m.KeyboardInput(t.layout.EncodeKeysym(ev.keysym, true))
+			m.KeyboardInput(t.layout.EncodeKeysym(ev.keysym, false))
+		case mouseEvent:
+			m.MouseMoved(t.screen.pixelAt(ev.col, ev.row))
+			if ev.button > 0 {
+				m.MouseButton(ev.button, ev.down)
+			}
+		}
+	}
+	return true
+}
+
+func (t *terminal) Display(fb *risc.Framebuffer, damage []image.Rectangle) {
+	cols, rows, err := term.GetSize(t.fd)
+	if err == nil && (cols != t.termCols || rows != t.termRows) {
+		t.termCols, t.termRows = cols, rows
+		t.screen.resize(cols, rows, t.scale)
+		damage = []image.Rectangle{image.Rect(0, 0, fb.Rect.Dx()/32-1, fb.Rect.Dy()-1)}
+	}
+	_, _ = t.out.Write(t.screen.update(damage))
+	_ = t.out.Flush()
+}
+
+// lastError is the error log of the machine. It keeps the last error
+// to report it after leaving the screen.
+type lastError struct {
+	err error
+}
+
+func (l *lastError) Write(p []byte) (int, error) {
+	l.err = errors.New(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+func readInput(r io.Reader, input chan<- []byte) {
+	defer close(input)
+	for {
+		buf := make([]byte, 256)
+		n, err := r.Read(buf)
+		if n > 0 {
+			input <- buf[:n]
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(message any) {
+	_, _ = fmt.Fprintln(os.Stderr, message)
+	os.Exit(1)
+}
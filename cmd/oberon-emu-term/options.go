@@ -0,0 +1,48 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+
+	"github.com/fzipp/oberon/emulator"
+	"github.com/fzipp/oberon/ps2"
+)
+
+type options struct {
+	machine emulator.Config
+	layout  *ps2.Layout
+	scale   int
+	blocks  bool
+	invert  bool
+}
+
+func optionsFromFlags() (*options, error) {
+	var machine emulator.Config
+	machine.RegisterFlags(flag.CommandLine)
+	scale := flag.Int("scale", 0, "Show `N`xN pixels per dot (default: fit the terminal)")
+	blocks := flag.Bool("blocks", false, "Draw with half blocks (1x2 dots per character) instead of Braille patterns (2x4 dots)")
+	invert := flag.Bool("invert", false, "Draw dots for black instead of white pixels")
+	layoutName := flag.String("layout", "us", "Type characters with the keyboard layout `NAME` of the Oberon keyboard driver: us, de or ch")
+
+	flag.Parse()
+
+	if err := machine.SetArgs(flag.Args()); err != nil {
+		return nil, err
+	}
+
+	layout, err := ps2.LayoutByName(*layoutName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &options{
+		machine: machine,
+		layout:  layout,
+		scale:   *scale,
+		blocks:  *blocks,
+		invert:  *invert,
+	}, nil
+}
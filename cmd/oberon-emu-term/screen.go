@@ -0,0 +1,187 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+
+	"github.com/fzipp/oberon/risc"
+)
+
+// A glyphSet draws a cell of dotsX by dotsY dots with a single character.
+type glyphSet struct {
+	dotsX int
+	dotsY int
+	glyph func(dots uint) rune // dot (x, y) is bit y*dotsX+x
+}
+
+// braille draws 2x4 dots per cell with the Unicode Braille Patterns.
+var braille = glyphSet{
+	dotsX: 2,
+	dotsY: 4,
+	glyph: func(dots uint) rune {
+		// The Braille dots are numbered down the left column first,
+		// with the bottom row added last.
+		const (
+			l0, r0 = 0x01, 0x08
+			l1, r1 = 0x02, 0x10
+			l2, r2 = 0x04, 0x20
+			l3, r3 = 0x40, 0x80
+		)
+		bits := [8]rune{l0, r0, l1, r1, l2, r2, l3, r3}
+		r := rune(0x2800)
+		for i, b := range bits {
+			if dots&(1<<i) != 0 {
+				r |= b
+			}
+		}
+		return r
+	},
+}
+
+// blocks draws 1x2 dots per cell with the half block characters.
+var blocks = glyphSet{
+	dotsX: 1,
+	dotsY: 2,
+	glyph: func(dots uint) rune {
+		return [4]rune{' ', '▀', '▄', '█'}[dots]
+	},
+}
+
+// A screen mirrors the framebuffer on the terminal. Each dot shows
+// whether a block of scale by scale pixels contains a white pixel,
+// or a black pixel if inverted. With a palette, the terminal colors are
+// set to the palette colors, otherwise the terminal's colors are used.
+type screen struct {
+	fb      *risc.Framebuffer
+	glyphs  glyphSet
+	invert  bool
+	palette *risc.Palette
+
+	scale int
+	cols  int
+	rows  int
+	cells []rune // as drawn on the terminal, 0 if unknown
+	out   bytes.Buffer
+}
+
+func newScreen(fb *risc.Framebuffer, glyphs glyphSet, invert bool, palette *risc.Palette) *screen {
+	return &screen{fb: fb, glyphs: glyphs, invert: invert, palette: palette}
+}
+
+// resize fits the framebuffer into a terminal of the given size, unless
+// a fixed scale is given, and schedules a full redraw.
+func (s *screen) resize(termCols, termRows, scale int) {
+	w, h := s.fb.Rect.Dx(), s.fb.Rect.Dy()
+	if scale <= 0 {
+		scale = max(
+			ceilDiv(w, s.glyphs.dotsX*max(termCols, 1)),
+			ceilDiv(h, s.glyphs.dotsY*max(termRows, 1)),
+			1,
+		)
+	}
+	s.scale = scale
+	s.cols = ceilDiv(w, s.glyphs.dotsX*scale)
+	s.rows = ceilDiv(h, s.glyphs.dotsY*scale)
+	s.cells = make([]rune, s.cols*s.rows)
+	if s.palette != nil {
+		fg, bg := s.palette.White, s.palette.Black
+		if s.invert {
+			fg, bg = bg, fg
+		}
+		fmt.Fprintf(&s.out, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm", fg.R, fg.G, fg.B, bg.R, bg.G, bg.B)
+	}
+	s.out.WriteString("\x1b[2J")
+}
+
+// update returns the terminal output that redraws the cells covering the
+// damaged rectangles, as returned by
+// risc.RISC.GetFramebufferDamageRectsAndReset. Only cells whose
+// character changes are written.
+func (s *screen) update(damage []image.Rectangle) []byte {
+	cellW := s.glyphs.dotsX * s.scale
+	cellH := s.glyphs.dotsY * s.scale
+	h := s.fb.Rect.Dy()
+	for _, d := range damage {
+		// Convert from words and lines, bottom-up, to cells.
+		r := image.Rect(
+			d.Min.X*32/cellW, (h-1-d.Max.Y)/cellH,
+			ceilDiv((d.Max.X+1)*32, cellW), ceilDiv(h-d.Min.Y, cellH),
+		).Intersect(image.Rect(0, 0, s.cols, s.rows))
+		for row := r.Min.Y; row < r.Max.Y; row++ {
+			s.updateRow(row, r.Min.X, r.Max.X)
+		}
+	}
+	p := bytes.Clone(s.out.Bytes())
+	s.out.Reset()
+	return p
+}
+
+func (s *screen) updateRow(row, minCol, maxCol int) {
+	cursor := -1
+	for col := minCol; col < maxCol; col++ {
+		c := s.cell(col, row)
+		i := row*s.cols + col
+		if s.cells[i] == c {
+			continue
+		}
+		s.cells[i] = c
+		if cursor != col {
+			fmt.Fprintf(&s.out, "\x1b[%d;%dH", row+1, col+1)
+		}
+		s.out.WriteRune(c)
+		cursor = col + 1
+	}
+}
+
+func (s *screen) cell(col, row int) rune {
+	var dots uint
+	for dy := range s.glyphs.dotsY {
+		for dx := range s.glyphs.dotsX {
+			x := (col*s.glyphs.dotsX + dx) * s.scale
+			y := (row*s.glyphs.dotsY + dy) * s.scale
+			if s.dot(x, y) {
+				dots |= 1 << (dy*s.glyphs.dotsX + dx)
+			}
+		}
+	}
+	return s.glyphs.glyph(dots)
+}
+
+// dot reports whether the block of pixels at (x, y), with the origin at
+// the top left, is set.
+func (s *screen) dot(x, y int) bool {
+	w, h := s.fb.Rect.Dx(), s.fb.Rect.Dy()
+	columns := w / 32
+	want := uint32(1)
+	if s.invert {
+		want = 0
+	}
+	for py := y; py < min(y+s.scale, h); py++ {
+		line := s.fb.Pix[(h-1-py)*columns:]
+		for px := x; px < min(x+s.scale, w); px++ {
+			if (line[px/32]>>(px%32))&1 == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pixelAt returns the framebuffer coordinates, with the origin at the
+// bottom left, of the center of a cell.
+func (s *screen) pixelAt(col, row int) (x, y int) {
+	cellW := s.glyphs.dotsX * s.scale
+	cellH := s.glyphs.dotsY * s.scale
+	x = col*cellW + cellW/2
+	y = row*cellH + cellH/2
+	return x, s.fb.Rect.Dy() - 1 - y
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
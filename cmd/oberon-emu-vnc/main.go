@@ -0,0 +1,51 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+// Command oberon-emu-vnc is an emulator for the Project Oberon RISC machine.
+// It serves the screen to VNC clients using the Remote Framebuffer Protocol.
+//
+// All connected clients share the same machine. The Control, Alt and Meta
+// keys simulate the left, middle and right mouse button.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/fzipp/oberon/emulator"
+)
+
+func main() {
+	opt, err := optionsFromFlags()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	m, err := emulator.New(opt.machine)
+	check(err)
+
+	l, err := net.Listen("tcp", opt.addr)
+	check(err)
+	fmt.Println("Connect a VNC client to " + l.Addr().String())
+
+	s := newServer(m, "Project Oberon", opt.layout)
+	go emulator.Run(m, s)
+	err = s.serve(l)
+	check(err)
+}
+
+func check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(message any) {
+	_, _ = fmt.Fprintln(os.Stderr, message)
+	os.Exit(1)
+}
@@ -0,0 +1,42 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+
+	"github.com/fzipp/oberon/emulator"
+	"github.com/fzipp/oberon/ps2"
+)
+
+type options struct {
+	machine emulator.Config
+	layout  *ps2.Layout
+	addr    string
+}
+
+func optionsFromFlags() (*options, error) {
+	var machine emulator.Config
+	machine.RegisterFlags(flag.CommandLine)
+	addr := flag.String("addr", "localhost:5900", "VNC service address (e.g., '127.0.0.1:5900' or ':5900' for all interfaces)")
+	layoutName := flag.String("layout", "us", "Type characters with the keyboard layout `NAME` of the Oberon keyboard driver: us, de or ch")
+
+	flag.Parse()
+
+	if err := machine.SetArgs(flag.Args()); err != nil {
+		return nil, err
+	}
+
+	layout, err := ps2.LayoutByName(*layoutName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &options{
+		machine: machine,
+		layout:  layout,
+		addr:    *addr,
+	}, nil
+}
@@ -0,0 +1,359 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/fzipp/oberon/risc"
+)
+
+// The Remote Framebuffer Protocol, version 3.8, as specified in RFC 6143.
+// Older clients speaking version 3.3 or 3.7 are accepted as well.
+
+const protocolVersion = "RFB 003.008\n"
+
+const securityNone = 1
+
+// Client-to-server message types
+const (
+	msgSetPixelFormat           = 0
+	msgSetEncodings             = 2
+	msgFramebufferUpdateRequest = 3
+	msgKeyEvent                 = 4
+	msgPointerEvent             = 5
+	msgClientCutText            = 6
+)
+
+// Server-to-client message types
+const (
+	msgFramebufferUpdate   = 0
+	msgSetColourMapEntries = 1
+	msgServerCutText       = 3
+)
+
+// Encodings of rectangles in framebuffer updates
+const (
+	encodingRaw = 0
+	encodingRRE = 2
+)
+
+// Limit for the length of cut text sent by a client.
+const maxCutText = 1 << 20
+
+// handshake negotiates the protocol version and the security type
+// with a newly connected client and reads its ClientInit message.
+// It reports whether the client is willing to share the desktop with
+// other clients.
+func handshake(rw io.ReadWriter) (shared bool, err error) {
+	if _, err := io.WriteString(rw, protocolVersion); err != nil {
+		return false, err
+	}
+	var version [12]byte
+	if _, err := io.ReadFull(rw, version[:]); err != nil {
+		return false, err
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(string(version[:]), "RFB %03d.%03d\n", &major, &minor); err != nil || major != 3 {
+		return false, fmt.Errorf("unsupported protocol version %q", version)
+	}
+
+	if minor >= 7 {
+		if _, err := rw.Write([]byte{1, securityNone}); err != nil {
+			return false, err
+		}
+		var selected [1]byte
+		if _, err := io.ReadFull(rw, selected[:]); err != nil {
+			return false, err
+		}
+		if selected[0] != securityNone {
+			return false, fmt.Errorf("unsupported security type %d", selected[0])
+		}
+		if minor >= 8 {
+			// SecurityResult: OK
+			if err := binary.Write(rw, binary.BigEndian, uint32(0)); err != nil {
+				return false, err
+			}
+		}
+	} else {
+		if err := binary.Write(rw, binary.BigEndian, uint32(securityNone)); err != nil {
+			return false, err
+		}
+	}
+
+	var clientInit [1]byte
+	if _, err := io.ReadFull(rw, clientInit[:]); err != nil {
+		return false, err
+	}
+	return clientInit[0] != 0, nil
+}
+
+// serverInit returns the ServerInit message describing the framebuffer.
+func serverInit(size image.Rectangle, pf pixelFormat, name string) []byte {
+	p := binary.BigEndian.AppendUint16(nil, uint16(size.Dx()))
+	p = binary.BigEndian.AppendUint16(p, uint16(size.Dy()))
+	p = append(p, pf.marshal()...)
+	p = binary.BigEndian.AppendUint32(p, uint32(len(name)))
+	return append(p, name...)
+}
+
+type pixelFormat struct {
+	bitsPerPixel uint8
+	depth        uint8
+	bigEndian    bool
+	trueColor    bool
+	redMax       uint16
+	greenMax     uint16
+	blueMax      uint16
+	redShift     uint8
+	greenShift   uint8
+	blueShift    uint8
+}
+
+// defaultPixelFormat is the pixel format the server proposes:
+// 32-bit little-endian true color.
+var defaultPixelFormat = pixelFormat{
+	bitsPerPixel: 32,
+	depth:        24,
+	trueColor:    true,
+	redMax:       255,
+	greenMax:     255,
+	blueMax:      255,
+	redShift:     16,
+	greenShift:   8,
+	blueShift:    0,
+}
+
+func (pf pixelFormat) marshal() []byte {
+	p := []byte{pf.bitsPerPixel, pf.depth, b2u8(pf.bigEndian), b2u8(pf.trueColor)}
+	p = binary.BigEndian.AppendUint16(p, pf.redMax)
+	p = binary.BigEndian.AppendUint16(p, pf.greenMax)
+	p = binary.BigEndian.AppendUint16(p, pf.blueMax)
+	return append(p, pf.redShift, pf.greenShift, pf.blueShift, 0, 0, 0)
+}
+
+func unmarshalPixelFormat(p []byte) (pixelFormat, error) {
+	pf := pixelFormat{
+		bitsPerPixel: p[0],
+		depth:        p[1],
+		bigEndian:    p[2] != 0,
+		trueColor:    p[3] != 0,
+		redMax:       binary.BigEndian.Uint16(p[4:]),
+		greenMax:     binary.BigEndian.Uint16(p[6:]),
+		blueMax:      binary.BigEndian.Uint16(p[8:]),
+		redShift:     p[10],
+		greenShift:   p[11],
+		blueShift:    p[12],
+	}
+	switch pf.bitsPerPixel {
+	case 8, 16, 32:
+		return pf, nil
+	}
+	return pf, fmt.Errorf("unsupported pixel format with %d bits per pixel", pf.bitsPerPixel)
+}
+
+// pixel encodes a color in the pixel format. Without true color the
+// pixel value is the index into the color map, see colourMapEntries.
+func (pf pixelFormat) pixel(c color.RGBA, index int) []byte {
+	v := uint32(index)
+	if pf.trueColor {
+		v = scale(c.R, pf.redMax)<<pf.redShift |
+			scale(c.G, pf.greenMax)<<pf.greenShift |
+			scale(c.B, pf.blueMax)<<pf.blueShift
+	}
+	switch pf.bitsPerPixel {
+	case 8:
+		return []byte{byte(v)}
+	case 16:
+		if pf.bigEndian {
+			return binary.BigEndian.AppendUint16(nil, uint16(v))
+		}
+		return binary.LittleEndian.AppendUint16(nil, uint16(v))
+	default:
+		if pf.bigEndian {
+			return binary.BigEndian.AppendUint32(nil, v)
+		}
+		return binary.LittleEndian.AppendUint32(nil, v)
+	}
+}
+
+func scale(x uint8, max uint16) uint32 {
+	return (uint32(x)*uint32(max) + 127) / 255
+}
+
+// colourMapEntries returns the SetColourMapEntries message that defines
+// the two colors of the framebuffer for clients without true color.
+func colourMapEntries(palette risc.Palette) []byte {
+	p := []byte{msgSetColourMapEntries, 0, 0, 0, 0, 2}
+	for _, c := range []color.RGBA{palette.Black, palette.White} {
+		p = binary.BigEndian.AppendUint16(p, uint16(c.R)<<8|uint16(c.R))
+		p = binary.BigEndian.AppendUint16(p, uint16(c.G)<<8|uint16(c.G))
+		p = binary.BigEndian.AppendUint16(p, uint16(c.B)<<8|uint16(c.B))
+	}
+	return p
+}
+
+// serverCutText returns the ServerCutText message for the text.
+func serverCutText(text string) []byte {
+	latin1 := latin1Encode(text)
+	p := []byte{msgServerCutText, 0, 0, 0}
+	p = binary.BigEndian.AppendUint32(p, uint32(len(latin1)))
+	return append(p, latin1...)
+}
+
+// latin1Decode converts cut text, which RFB encodes in ISO 8859-1, to
+// UTF-8.
+func latin1Decode(p []byte) string {
+	runes := make([]rune, len(p))
+	for i, b := range p {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// latin1Encode converts text to ISO 8859-1 for the cut text messages.
+// Characters outside of ISO 8859-1 become '?'.
+func latin1Encode(s string) []byte {
+	p := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			r = '?'
+		}
+		p = append(p, byte(r))
+	}
+	return p
+}
+
+// An encoder appends framebuffer update rectangles in a client's pixel
+// format and preferred encoding.
+type encoder struct {
+	pixels [2][]byte // pixel values of the palette colors
+	rre    bool
+}
+
+func newEncoder(pf pixelFormat, rre bool, palette risc.Palette) *encoder {
+	return &encoder{
+		pixels: [2][]byte{pf.pixel(palette.Black, 0), pf.pixel(palette.White, 1)},
+		rre:    rre,
+	}
+}
+
+// framebufferUpdate appends a FramebufferUpdate message with the given
+// rectangles of the framebuffer, in pixels with the origin at the top left.
+func (e *encoder) framebufferUpdate(p []byte, fb *risc.Framebuffer, rects []image.Rectangle) []byte {
+	p = append(p, msgFramebufferUpdate, 0)
+	p = binary.BigEndian.AppendUint16(p, uint16(len(rects)))
+	for _, r := range rects {
+		p = binary.BigEndian.AppendUint16(p, uint16(r.Min.X))
+		p = binary.BigEndian.AppendUint16(p, uint16(r.Min.Y))
+		p = binary.BigEndian.AppendUint16(p, uint16(r.Dx()))
+		p = binary.BigEndian.AppendUint16(p, uint16(r.Dy()))
+		if e.rre {
+			if q, ok := e.appendRRE(p, fb, r); ok {
+				p = q
+				continue
+			}
+		}
+		p = e.appendRaw(p, fb, r)
+	}
+	return p
+}
+
+func (e *encoder) appendRaw(p []byte, fb *risc.Framebuffer, r image.Rectangle) []byte {
+	p = binary.BigEndian.AppendUint32(p, encodingRaw)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p = append(p, e.pixels[pixelAt(fb, x, y)]...)
+		}
+	}
+	return p
+}
+
+// appendRRE appends the rectangle r in RRE encoding: the majority color
+// as background, and the other pixels as subrectangles that are joined
+// from horizontal runs. It reports false and leaves p unchanged if the
+// result would be larger than the raw encoding.
+func (e *encoder) appendRRE(p []byte, fb *risc.Framebuffer, r image.Rectangle) ([]byte, bool) {
+	ones := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			ones += pixelAt(fb, x, y)
+		}
+	}
+	bg := 0
+	if 2*ones > r.Dx()*r.Dy() {
+		bg = 1
+	}
+
+	var subrects []image.Rectangle
+	open := map[[2]int]int{}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		next := map[[2]int]int{}
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if pixelAt(fb, x, y) == bg {
+				continue
+			}
+			start := x
+			for x+1 < r.Max.X && pixelAt(fb, x+1, y) != bg {
+				x++
+			}
+			run := [2]int{start, x + 1}
+			if i, ok := open[run]; ok {
+				subrects[i].Max.Y = y + 1
+				next[run] = i
+				continue
+			}
+			next[run] = len(subrects)
+			subrects = append(subrects, image.Rect(start-r.Min.X, y-r.Min.Y, x+1-r.Min.X, y+1-r.Min.Y))
+		}
+		open = next
+	}
+
+	bpp := len(e.pixels[0])
+	if 4+bpp+len(subrects)*(bpp+8) >= r.Dx()*r.Dy()*bpp {
+		return p, false
+	}
+	p = binary.BigEndian.AppendUint32(p, encodingRRE)
+	p = binary.BigEndian.AppendUint32(p, uint32(len(subrects)))
+	p = append(p, e.pixels[bg]...)
+	for _, s := range subrects {
+		p = append(p, e.pixels[1-bg]...)
+		p = binary.BigEndian.AppendUint16(p, uint16(s.Min.X))
+		p = binary.BigEndian.AppendUint16(p, uint16(s.Min.Y))
+		p = binary.BigEndian.AppendUint16(p, uint16(s.Dx()))
+		p = binary.BigEndian.AppendUint16(p, uint16(s.Dy()))
+	}
+	return p, true
+}
+
+// pixelAt returns the bit of the pixel at (x, y), with the origin at the
+// top left.
+func pixelAt(fb *risc.Framebuffer, x, y int) int {
+	columns := fb.Rect.Dx() / 32
+	word := fb.Pix[(fb.Rect.Dy()-1-y)*columns+x/32]
+	return int(word>>(x%32)) & 1
+}
+
+// damageToPixels converts a framebuffer damage rectangle, as returned by
+// risc.RISC.GetFramebufferDamageRectsAndReset, to pixel coordinates with
+// the origin at the top left.
+func damageToPixels(fb *risc.Framebuffer, d image.Rectangle) image.Rectangle {
+	h := fb.Rect.Dy()
+	return image.Rect(d.Min.X*32, h-1-d.Max.Y, (d.Max.X+1)*32, h-d.Min.Y)
+}
+
+var errTooLong = errors.New("cut text too long")
+
+func b2u8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,405 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/fzipp/oberon/clipboard"
+	"github.com/fzipp/oberon/emulator"
+	"github.com/fzipp/oberon/ps2"
+	"github.com/fzipp/oberon/risc"
+)
+
+// maxDamageRects is the number of pending damage rectangles of a client
+// above which they are joined into their bounding box.
+const maxDamageRects = 64
+
+// A server shows one machine to all connected VNC clients. Each client
+// can control the mouse and the keyboard.
+type server struct {
+	mu        sync.Mutex
+	m         *emulator.Machine
+	name      string
+	layout    *ps2.Layout
+	clipboard *clipboard.Memory // cut text of the clients
+	clients   []*client
+}
+
+func newServer(m *emulator.Machine, name string, layout *ps2.Layout) *server {
+	s := &server{m: m, name: name, layout: layout}
+	s.clipboard = clipboard.NewMemory(s.sendCutText)
+	m.RISC().SetClipboard(clipboard.New(s.clipboard))
+	return s
+}
+
+// Input locks the server for the frame. The clients' input is passed
+// to the machine as it arrives.
+func (s *server) Input(*emulator.Machine) bool {
+	s.mu.Lock()
+	return true
+}
+
+// Display collects the display updates of the frame for the clients
+// and unlocks the server.
+func (s *server) Display(fb *risc.Framebuffer, damage []image.Rectangle) {
+	defer s.mu.Unlock()
+	if len(damage) == 0 {
+		return
+	}
+	for _, c := range s.clients {
+		for _, d := range damage {
+			c.addDamage(damageToPixels(fb, d))
+		}
+		c.notify()
+	}
+}
+
+// serve accepts VNC client connections on the listener.
+func (s *server) serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+	shared, err := handshake(conn)
+	if err != nil {
+		log.Printf("%s: handshake failed: %s", conn.RemoteAddr(), err)
+		return
+	}
+	c, err := s.attach(conn, shared)
+	if err != nil {
+		log.Printf("%s: %s", conn.RemoteAddr(), err)
+		return
+	}
+	defer s.detach(c)
+
+	go c.writeMessages()
+	err = c.readMessages()
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		log.Printf("%s: %s", conn.RemoteAddr(), err)
+	}
+}
+
+// attach sends the ServerInit message to a client and adds it to the
+// clients receiving updates. A client that does not want to share the
+// desktop disconnects all others.
+func (s *server) attach(conn net.Conn, shared bool) (*client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fb := s.m.Framebuffer()
+	_, err := conn.Write(serverInit(fb.Rect, defaultPixelFormat, s.name))
+	if err != nil {
+		return nil, err
+	}
+	if !shared {
+		for _, other := range s.clients {
+			_ = other.conn.Close()
+		}
+	}
+	c := &client{
+		s:       s,
+		conn:    conn,
+		pf:      defaultPixelFormat,
+		encoder: newEncoder(defaultPixelFormat, false, fb.Palette),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	s.clients = append(s.clients, c)
+	return c, nil
+}
+
+func (s *server) detach(c *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clients = slices.DeleteFunc(s.clients, func(other *client) bool {
+		return other == c
+	})
+	close(c.done)
+}
+
+// sendCutText passes text put on the Oberon clipboard to all clients.
+// It is called by the machine, so s.mu is already held.
+func (s *server) sendCutText(text string) {
+	for _, c := range s.clients {
+		c.cutText = append(c.cutText, text)
+		c.notify()
+	}
+}
+
+// A client is a connected VNC viewer. Except for conn, wake and done,
+// its fields are guarded by the server's mutex.
+type client struct {
+	s    *server
+	conn net.Conn
+	wake chan struct{}
+	done chan struct{}
+
+	pf       pixelFormat
+	rre      bool
+	encoder  *encoder
+	colorMap bool // SetColourMapEntries pending
+
+	damage      []image.Rectangle // in pixels, origin at the top left
+	request     image.Rectangle
+	requested   bool
+	incremental bool
+	cutText     []string
+
+	buttons uint8 // pointer button mask of the last pointer event
+}
+
+// notify wakes up the writer of the client.
+func (c *client) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *client) addDamage(r image.Rectangle) {
+	c.damage = append(c.damage, r)
+	if len(c.damage) > maxDamageRects {
+		union := image.Rectangle{}
+		for _, d := range c.damage {
+			union = union.Union(d)
+		}
+		c.damage = append(c.damage[:0], union)
+	}
+}
+
+// writeMessages sends the pending server messages to the client whenever
+// it is woken up, until the client is detached.
+func (c *client) writeMessages() {
+	for {
+		select {
+		case <-c.wake:
+		case <-c.done:
+			return
+		}
+		c.s.mu.Lock()
+		p := c.pendingMessages()
+		c.s.mu.Unlock()
+		if len(p) == 0 {
+			continue
+		}
+		if _, err := c.conn.Write(p); err != nil {
+			_ = c.conn.Close()
+			return
+		}
+	}
+}
+
+// pendingMessages returns the messages that are ready to be sent.
+// A framebuffer update is only sent in response to an update request,
+// and to an incremental request only once a part of the requested
+// region has changed.
+func (c *client) pendingMessages() []byte {
+	var p []byte
+	if c.colorMap {
+		p = append(p, colourMapEntries(c.s.m.Framebuffer().Palette)...)
+		c.colorMap = false
+	}
+	for _, text := range c.cutText {
+		p = append(p, serverCutText(text)...)
+	}
+	c.cutText = nil
+
+	if !c.requested {
+		return p
+	}
+	var rects, remaining []image.Rectangle
+	if !c.incremental {
+		rects = append(rects, c.request)
+	}
+	for _, d := range c.damage {
+		if !d.In(c.request) {
+			remaining = append(remaining, d)
+		}
+		if c.incremental {
+			if r := d.Intersect(c.request); !r.Empty() {
+				rects = append(rects, r)
+			}
+		}
+	}
+	if len(rects) == 0 {
+		return p
+	}
+	c.damage = remaining
+	c.requested = false
+	return c.encoder.framebufferUpdate(p, c.s.m.Framebuffer(), rects)
+}
+
+// readMessages handles the messages from the client until the connection
+// is closed.
+func (c *client) readMessages() error {
+	rd := bufio.NewReader(c.conn)
+	var buf [20]byte
+	for {
+		msgType, err := rd.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch msgType {
+		case msgSetPixelFormat:
+			p := buf[:19]
+			if _, err := io.ReadFull(rd, p); err != nil {
+				return err
+			}
+			pf, err := unmarshalPixelFormat(p[3:])
+			if err != nil {
+				return err
+			}
+			c.s.mu.Lock()
+			c.pf = pf
+			c.encoder = newEncoder(pf, c.rre, c.s.m.Framebuffer().Palette)
+			c.colorMap = !pf.trueColor
+			c.s.mu.Unlock()
+			c.notify()
+
+		case msgSetEncodings:
+			p := buf[:3]
+			if _, err := io.ReadFull(rd, p); err != nil {
+				return err
+			}
+			encodings := make([]byte, 4*int(binary.BigEndian.Uint16(p[1:])))
+			if _, err := io.ReadFull(rd, encodings); err != nil {
+				return err
+			}
+			rre := false
+			for i := 0; i < len(encodings); i += 4 {
+				if int32(binary.BigEndian.Uint32(encodings[i:])) == encodingRRE {
+					rre = true
+				}
+			}
+			c.s.mu.Lock()
+			c.rre = rre
+			c.encoder = newEncoder(c.pf, rre, c.s.m.Framebuffer().Palette)
+			c.s.mu.Unlock()
+
+		case msgFramebufferUpdateRequest:
+			p := buf[:9]
+			if _, err := io.ReadFull(rd, p); err != nil {
+				return err
+			}
+			x := int(binary.BigEndian.Uint16(p[1:]))
+			y := int(binary.BigEndian.Uint16(p[3:]))
+			w := int(binary.BigEndian.Uint16(p[5:]))
+			h := int(binary.BigEndian.Uint16(p[7:]))
+			c.s.mu.Lock()
+			c.request = image.Rect(x, y, x+w, y+h).Intersect(c.s.m.Framebuffer().Rect)
+			c.requested = !c.request.Empty()
+			c.incremental = p[0] != 0
+			c.s.mu.Unlock()
+			c.notify()
+
+		case msgKeyEvent:
+			p := buf[:7]
+			if _, err := io.ReadFull(rd, p); err != nil {
+				return err
+			}
+			c.s.mu.Lock()
+			c.keyEvent(binary.BigEndian.Uint32(p[3:]), p[0] != 0)
+			c.s.mu.Unlock()
+
+		case msgPointerEvent:
+			p := buf[:5]
+			if _, err := io.ReadFull(rd, p); err != nil {
+				return err
+			}
+			c.s.mu.Lock()
+			c.pointerEvent(p[0], int(binary.BigEndian.Uint16(p[1:])), int(binary.BigEndian.Uint16(p[3:])))
+			c.s.mu.Unlock()
+
+		case msgClientCutText:
+			p := buf[:7]
+			if _, err := io.ReadFull(rd, p); err != nil {
+				return err
+			}
+			n := binary.BigEndian.Uint32(p[3:])
+			if n > maxCutText {
+				return errTooLong
+			}
+			text := make([]byte, n)
+			if _, err := io.ReadFull(rd, text); err != nil {
+				return err
+			}
+			c.s.mu.Lock()
+			c.s.clipboard.Update(latin1Decode(text))
+			c.s.mu.Unlock()
+
+		default:
+			return fmt.Errorf("unknown message type %d", msgType)
+		}
+	}
+}
+
+// keyEvent forwards a key to the machine. The Control, Alt and Meta keys
+// simulate the left, middle and right mouse button, like in the other
+// frontends.
+func (c *client) keyEvent(keysym uint32, down bool) {
+	m := c.s.m
+	switch keysym {
+	case xkControlL, xkControlR:
+		m.MouseButton(1, down)
+	case xkAltL, xkAltR:
+		m.MouseButton(2, down)
+	case xkMetaL, xkMetaR, xkSuperL, xkSuperR:
+		m.MouseButton(3, down)
+	default:
+		m.KeyboardInput(c.s.layout.EncodeKeysym(keysym, down))
+	}
+}
+
+// pointerEvent forwards the pointer position and the changes of the
+// left, middle and right button (bits 0, 1 and 2 of the mask). Pressing
+// button 4 or 5 (bits 3 and 4) turns the wheel up or down by one step.
+func (c *client) pointerEvent(mask uint8, x, y int) {
+	m := c.s.m
+	m.MouseMoved(x, m.Framebuffer().Rect.Dy()-y-1)
+	for i := range 3 {
+		bit := uint8(1) << i
+		if (mask^c.buttons)&bit != 0 {
+			m.MouseButton(i+1, mask&bit != 0)
+		}
+	}
+	pressed := mask &^ c.buttons
+	if pressed&(1<<3) != 0 {
+		m.MouseWheel(-1)
+	}
+	if pressed&(1<<4) != 0 {
+		m.MouseWheel(1)
+	}
+	c.buttons = mask
+}
+
+// X11 keysyms of the modifier keys that simulate the mouse buttons
+const (
+	xkControlL = 0xFFE3
+	xkControlR = 0xFFE4
+	xkMetaL    = 0xFFE7
+	xkMetaR    = 0xFFE8
+	xkAltL     = 0xFFE9
+	xkAltR     = 0xFFEA
+	xkSuperL   = 0xFFEB
+	xkSuperR   = 0xFFEC
+)
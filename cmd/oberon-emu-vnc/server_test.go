@@ -0,0 +1,190 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"io"
+	"log"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fzipp/oberon/emulator"
+	"github.com/fzipp/oberon/ps2"
+	"github.com/fzipp/oberon/risc"
+)
+
+// inputProgram is a boot ROM that copies the mouse register to address
+// 0x100 and the scancodes from the keyboard to the words from address
+// 0x200 on, so that the tests can see the input passed to the machine.
+var inputProgram = []uint32{
+	0x5100FFD8, //     MOV  R1, -40      ; mouse and keyboard registers
+	0x43000200, //     MOV  R3, 200H
+	0x82100000, // L:  LDW  R2, R1, 0
+	0xA2000100, //     STW  R2, R0, 100H
+	0x64001000, //     MOV' R4, 1000H    ; keyboard ready bit
+	0x04240004, //     AND  R4, R2, R4
+	0xE1FFFFFB, //     BEQ  L
+	0x85100004, //     LDW  R5, R1, 4
+	0xA5300000, //     STW  R5, R3, 0
+	0x43380004, //     ADD  R3, R3, 4
+	0xE7FFFFF7, //     B    L
+}
+
+// testClient is the client end of a connection to a server.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func startTestServer(t *testing.T) (*server, *testClient) {
+	t.Helper()
+	m, err := emulator.New(emulator.Config{
+		Palette: &risc.Palette{
+			Black: color.RGBA{A: 0xFF},
+			White: color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RISC().SetROM(inputProgram); err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(m, "Test", ps2.US)
+	clientConn, serverConn := net.Pipe()
+	go s.handle(serverConn)
+	t.Cleanup(func() { _ = clientConn.Close() })
+	return s, &testClient{t: t, conn: clientConn}
+}
+
+func (c *testClient) send(p ...byte) {
+	c.t.Helper()
+	_ = c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Write(p); err != nil {
+		c.t.Fatalf("write % X: %v", p, err)
+	}
+}
+
+func (c *testClient) receive(n int) []byte {
+	c.t.Helper()
+	_ = c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	p := make([]byte, n)
+	if _, err := io.ReadFull(c.conn, p); err != nil {
+		c.t.Fatalf("read %d bytes: %v", n, err)
+	}
+	return p
+}
+
+func (c *testClient) expect(what string, want ...byte) {
+	c.t.Helper()
+	if got := c.receive(len(want)); !bytes.Equal(got, want) {
+		c.t.Fatalf("%s:\ngot  % X\nwant % X", what, got, want)
+	}
+}
+
+func (c *testClient) updateRequest(incremental bool, x, y, w, h uint16) {
+	c.t.Helper()
+	p := []byte{msgFramebufferUpdateRequest, b2u8(incremental)}
+	for _, v := range []uint16{x, y, w, h} {
+		p = binary.BigEndian.AppendUint16(p, v)
+	}
+	c.send(p...)
+}
+
+func TestServer(t *testing.T) {
+	s, c := startTestServer(t)
+
+	// Handshake of protocol version 3.8 without security
+	c.expect("ProtocolVersion", []byte(protocolVersion)...)
+	c.send([]byte(protocolVersion)...)
+	c.expect("security types", 1, securityNone)
+	c.send(securityNone)
+	c.expect("SecurityResult", 0, 0, 0, 0)
+	c.send(1) // ClientInit: shared
+
+	// ServerInit: 1024x768 pixels, the default pixel format and the name
+	serverInit := []byte{0x04, 0x00, 0x03, 0x00}
+	serverInit = append(serverInit, defaultPixelFormat.marshal()...)
+	serverInit = append(serverInit, 0, 0, 0, 4, 'T', 'e', 's', 't')
+	c.expect("ServerInit", serverInit...)
+
+	// Four white pixels at the top left of the screen
+	fb := s.m.Framebuffer()
+	fb.Pix[(fb.Rect.Dy()-1)*fb.Rect.Dx()/32] = 0x0000000F
+
+	// 8-bit pixels with a color map
+	c.send(append([]byte{msgSetPixelFormat, 0, 0, 0}, pixelFormat{bitsPerPixel: 8, depth: 8}.marshal()...)...)
+	c.expect("SetColourMapEntries", msgSetColourMapEntries, 0, 0, 0, 0, 2,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+
+	c.send(msgSetEncodings, 0, 0, 1, 0, 0, 0, encodingRaw)
+	c.updateRequest(false, 0, 0, 8, 2)
+	c.expect("Raw update", msgFramebufferUpdate, 0, 0, 1,
+		0, 0, 0, 0, 0, 8, 0, 2, 0, 0, 0, encodingRaw,
+		1, 1, 1, 1, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0)
+
+	c.send(msgSetEncodings, 0, 0, 2, 0, 0, 0, encodingRRE, 0, 0, 0, encodingRaw)
+	c.updateRequest(false, 0, 0, 32, 4)
+	c.expect("RRE update", msgFramebufferUpdate, 0, 0, 1,
+		0, 0, 0, 0, 0, 32, 0, 4, 0, 0, 0, encodingRRE,
+		0, 0, 0, 1, // one subrectangle
+		0,                         // black background
+		1, 0, 0, 0, 0, 0, 4, 0, 1) // white 4x1 at (0, 0)
+
+	// Return is typed, Alt presses the middle mouse button, and the
+	// pointer event moves the mouse and presses the left button.
+	c.send(msgKeyEvent, 1, 0, 0, 0x00, 0x00, 0xFF, 0x0D)
+	c.send(msgKeyEvent, 0, 0, 0, 0x00, 0x00, 0xFF, 0x0D)
+	c.send(msgKeyEvent, 1, 0, 0, 0x00, 0x00, 0xFF, 0xE9)
+	c.send(msgPointerEvent, 1, 0, 10, 0, 20)
+	c.send(msgClientCutText, 0, 0, 0, 0, 0, 0, 5, 'h', 0xE9, 'l', 'l', 'o')
+
+	// The response to an update request shows that the server handled
+	// the messages before it.
+	c.updateRequest(false, 31, 0, 1, 1)
+	c.expect("Raw update", msgFramebufferUpdate, 0, 0, 1,
+		0, 31, 0, 0, 0, 1, 0, 1, 0, 0, 0, encodingRaw, 0)
+
+	if text, _ := s.clipboard.Text(); text != "héllo" {
+		t.Errorf("clipboard text: got %q, want %q", text, "héllo")
+	}
+
+	if _, err := s.m.Frame(); err != nil {
+		t.Fatal(err)
+	}
+	r := s.m.RISC()
+	mouse := r.Mem[0x100/4] & 0x07FFFFFF
+	if want := uint32(10 | (768-20-1)<<12 | 1<<26 | 1<<25); mouse != want {
+		t.Errorf("mouse: got %08X, want %08X", mouse, want)
+	}
+	var keys []byte
+	for _, w := range r.Mem[0x200/4 : 0x200/4+8] {
+		if w != 0 {
+			keys = append(keys, byte(w))
+		}
+	}
+	if want := []byte{0x5A, 0xF0, 0x5A}; !bytes.Equal(keys, want) {
+		t.Errorf("scancodes: got % X, want % X", keys, want)
+	}
+}
+
+func TestServerUnsupportedVersion(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	_, c := startTestServer(t)
+	c.expect("ProtocolVersion", []byte(protocolVersion)...)
+	c.send([]byte("RFB 004.000\n")...)
+	_ = c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read after unsupported version: got %v, want EOF", err)
+	}
+}
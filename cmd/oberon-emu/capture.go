@@ -0,0 +1,96 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"time"
+
+	"github.com/fzipp/oberon/capture"
+	"github.com/fzipp/oberon/risc"
+)
+
+// A screenCapture saves screenshots and screen recordings of the
+// framebuffer as files.
+type screenCapture struct {
+	fb  *risc.Framebuffer
+	dir string // directory for screenshots and recordings
+
+	rec     *capture.Recorder // nil if not recording
+	recFile string
+}
+
+func newScreenCapture(fb *risc.Framebuffer, dir string) *screenCapture {
+	return &screenCapture{fb: fb, dir: dir}
+}
+
+// screenshot saves the current screen as a PNG file.
+func (c *screenCapture) screenshot() {
+	name := capture.FileName(c.dir, time.Now(), ".png")
+	err := writeFile(name, func(f *os.File) error {
+		return capture.WritePNG(f, c.fb)
+	})
+	report("screenshot", name, err)
+}
+
+// startRecording starts recording the screen to an animated GIF file.
+func (c *screenCapture) startRecording(file string) {
+	t := time.Now()
+	if file == "" {
+		file = capture.FileName(c.dir, t, ".gif")
+	}
+	c.rec = capture.NewRecorder(c.fb, t)
+	c.recFile = file
+	fmt.Println("Recording to " + file)
+}
+
+// stopRecording ends the recording, if any, and saves it.
+func (c *screenCapture) stopRecording() {
+	if c.rec == nil {
+		return
+	}
+	err := writeFile(c.recFile, func(f *os.File) error {
+		return c.rec.WriteGIF(f, time.Now())
+	})
+	report("recording", c.recFile, err)
+	c.rec = nil
+}
+
+func (c *screenCapture) toggleRecording() {
+	if c.rec != nil {
+		c.stopRecording()
+	} else {
+		c.startRecording("")
+	}
+}
+
+// update adds the damaged parts of the screen to the recording.
+func (c *screenCapture) update(damage []image.Rectangle) {
+	if c.rec != nil {
+		c.rec.Update(damage, time.Now())
+	}
+}
+
+func writeFile(name string, write func(*os.File) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func report(what, name string, err error) {
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "can't save %s: %s\n", what, err)
+		return
+	}
+	fmt.Printf("Saved %s to %s\n", what, name)
+}
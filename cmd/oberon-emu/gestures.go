@@ -0,0 +1,154 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"image"
+	"time"
+
+	"github.com/fzipp/oberon/emulator"
+
+	"github.com/fzipp/oberon/cmd/oberon-emu/internal/canvas"
+)
+
+const (
+	// A finger held in place for longPress presses the middle button.
+	longPress = 500 * time.Millisecond
+	// A tap holds its button for at least minClick, so that Oberon
+	// sees it although it polls the mouse only once in a while.
+	minClick = 50 * time.Millisecond
+	// A finger that moves more than dragDistance canvas pixels before
+	// the long press drags with the left button.
+	dragDistance = 8
+)
+
+// Scroll distances of one step of the mouse wheel.
+const (
+	wheelStepPixels = 100
+	wheelStepLines  = 3
+	wheelPageSteps  = 10
+)
+
+// gestures maps the wheel and the touch gestures in the browser to the
+// mouse of the machine:
+//
+//   - tap: left click (set caret)
+//   - long press: middle button, held until the finger is lifted (execute)
+//   - two fingers: right button, held until all fingers are lifted (select)
+//   - dragging one finger: left button drag
+//
+// The first finger always moves the mouse.
+type gestures struct {
+	wheel float64 // scrolled steps not yet passed to the machine
+
+	touching bool      // at least one finger touches the screen
+	finger   uint32    // identifier of the finger that moves the mouse
+	start    time.Time // time the first finger touched the screen
+	startPos image.Point
+	button   int       // button pressed by the gesture, or 0
+	pressed  time.Time // time the button was pressed
+	release  bool      // release the button once minClick has passed
+}
+
+func (g *gestures) wheelEvent(m *emulator.Machine, ev canvas.WheelEvent) {
+	switch ev.DeltaMode {
+	case canvas.DeltaPixel:
+		g.wheel += ev.DeltaY / wheelStepPixels
+	case canvas.DeltaLine:
+		g.wheel += ev.DeltaY / wheelStepLines
+	case canvas.DeltaPage:
+		g.wheel += ev.DeltaY * wheelPageSteps
+	}
+	steps := int(g.wheel)
+	if steps != 0 {
+		g.wheel -= float64(steps)
+		m.MouseWheel(steps)
+	}
+}
+
+func (g *gestures) touchStart(m *emulator.Machine, height int, touches canvas.TouchList, now time.Time) {
+	if len(touches) == 0 {
+		return
+	}
+	if !g.touching {
+		if g.button != 0 {
+			// A tap is still being released.
+			g.releaseButton(m)
+		}
+		t := touches[0]
+		g.touching = true
+		g.finger = t.Identifier
+		g.start = now
+		g.startPos = image.Pt(t.X, t.Y)
+		m.MouseMoved(t.X, height-t.Y-1)
+	}
+	if len(touches) >= 2 && g.button == 0 {
+		g.press(m, 3, now)
+	}
+}
+
+func (g *gestures) touchMove(m *emulator.Machine, height int, touches canvas.TouchList, now time.Time) {
+	for _, t := range touches {
+		if t.Identifier != g.finger {
+			continue
+		}
+		m.MouseMoved(t.X, height-t.Y-1)
+		d := image.Pt(t.X, t.Y).Sub(g.startPos)
+		if g.button == 0 && max(d.X, -d.X, d.Y, -d.Y) > dragDistance {
+			g.press(m, 1, now)
+		}
+		return
+	}
+}
+
+// touchEnd handles lifted fingers; touches are the fingers that still
+// touch the screen. If cancel is set, the gesture was interrupted and
+// a tap doesn't click.
+func (g *gestures) touchEnd(m *emulator.Machine, touches canvas.TouchList, now time.Time, cancel bool) {
+	if !g.touching {
+		return
+	}
+	if len(touches) > 0 {
+		for _, t := range touches {
+			if t.Identifier == g.finger {
+				return
+			}
+		}
+		g.finger = touches[0].Identifier
+		return
+	}
+	g.touching = false
+	if g.button == 0 {
+		if cancel {
+			return
+		}
+		g.press(m, 1, now)
+	}
+	g.release = true
+	g.tick(m, now)
+}
+
+// tick presses the middle button after a long press and releases the
+// button of a finished gesture. It is called before each frame.
+func (g *gestures) tick(m *emulator.Machine, now time.Time) {
+	if g.touching && g.button == 0 && now.Sub(g.start) >= longPress {
+		g.press(m, 2, now)
+	}
+	if g.release && now.Sub(g.pressed) >= minClick {
+		g.releaseButton(m)
+	}
+}
+
+func (g *gestures) press(m *emulator.Machine, button int, now time.Time) {
+	m.MouseButton(button, true)
+	g.button = button
+	g.pressed = now
+}
+
+func (g *gestures) releaseButton(m *emulator.Machine) {
+	m.MouseButton(g.button, false)
+	g.button = 0
+	g.release = false
+}
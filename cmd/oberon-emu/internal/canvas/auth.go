@@ -0,0 +1,130 @@
+// Copyright 2020 Frederik Zipp. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canvas
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const tokenCookie = "canvas-token"
+
+// authenticate wraps the handler with the token and basic authentication
+// checks that are enabled in the config.
+func (c *config) authenticate(next http.Handler) http.Handler {
+	if c.token == "" && c.user == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.user != "" {
+			user, password, ok := r.BasicAuth()
+			if !ok || !equal(user, c.user) || !equal(password, c.password) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="canvas", charset="UTF-8"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if c.token != "" {
+			query := r.URL.Query()
+			if query.Has("token") && equal(query.Get("token"), c.token) {
+				http.SetCookie(w, &http.Cookie{
+					Name:     tokenCookie,
+					Value:    c.token,
+					Path:     "/",
+					Secure:   r.TLS != nil,
+					HttpOnly: true,
+					SameSite: http.SameSiteStrictMode,
+				})
+				if r.URL.Path == "/" {
+					// Remove the token from the address bar.
+					query.Del("token")
+					u := url.URL{Path: "/", RawQuery: query.Encode()}
+					http.Redirect(w, r, u.String(), http.StatusSeeOther)
+					return
+				}
+			} else if cookie, err := r.Cookie(tokenCookie); err != nil || !equal(cookie.Value, c.token) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// checkOrigin reports whether a WebSocket connection request comes from
+// a page of the server's own origin or of one of the allowed origins.
+// Requests without an Origin header do not come from a browser and are
+// accepted.
+func (c *config) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range c.allowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// selfSignedCertificate generates a certificate for localhost and the
+// host of the given listen address.
+func selfSignedCertificate(addr string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"canvas self-signed"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" && host != "localhost" {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
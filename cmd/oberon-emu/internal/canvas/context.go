@@ -1,23 +1,33 @@
 package canvas
 
 import (
+	"bytes"
+	"compress/flate"
 	"image"
+	"image/color"
 
 	"github.com/fzipp/oberon/risc"
 )
 
 type Context struct {
-	config config
-	draws  chan<- []byte
-	events <-chan Event
-	buf    buffer
+	config   config
+	draws    chan<- []byte
+	events   <-chan Event
+	buf      buffer
+	encoding encoding
+	viewOnly bool
+
+	packed     buffer
+	compressed bytes.Buffer
+	deflater   *flate.Writer
 }
 
-func newContext(draws chan<- []byte, events <-chan Event, config config) *Context {
+func newContext(draws chan<- []byte, events <-chan Event, config config, enc encoding) *Context {
 	return &Context{
-		config: config,
-		draws:  draws,
-		events: events,
+		config:   config,
+		draws:    draws,
+		events:   events,
+		encoding: enc,
 	}
 }
 
@@ -25,6 +35,12 @@ func (ctx *Context) Events() <-chan Event {
 	return ctx.events
 }
 
+// ViewOnly reports whether the browser asked for a view-only session
+// by opening the page with the "view" URL parameter.
+func (ctx *Context) ViewOnly() bool {
+	return ctx.viewOnly
+}
+
 func (ctx *Context) CanvasWidth() int {
 	return ctx.config.width
 }
@@ -33,21 +49,36 @@ func (ctx *Context) CanvasHeight() int {
 	return ctx.config.height
 }
 
-const (
-	colorBlack = 0x657b83ff
-	colorWhite = 0xfdf6e3ff
-)
-
 const (
 	bUpdateDisplay byte = 1 + iota
 	bClipboardWriteText
+	bUpdateDisplayPacked
+	bUpdateDisplayDeflate
+	bResizeCanvas
+	bSetLEDs
 )
 
+// UpdateDisplay sends the damaged rectangle r of the framebuffer to the
+// browser. The rectangle is given in framebuffer words (x) and lines (y),
+// as returned by risc.RISC.GetFramebufferDamageAndReset or
+// risc.RISC.GetFramebufferDamageRectsAndReset.
 func (ctx *Context) UpdateDisplay(fb *risc.Framebuffer, r image.Rectangle) {
 	if r.Min.Y > r.Max.Y {
 		return
 	}
+	switch ctx.encoding {
+	case encodingPacked:
+		ctx.updateDisplayPacked(fb, r)
+	case encodingDeflate:
+		ctx.updateDisplayDeflate(fb, r)
+	default:
+		ctx.updateDisplayRGBA(fb, r)
+	}
+}
 
+// updateDisplayRGBA sends each pixel as a 32-bit RGBA value,
+// 32 times the size of the framebuffer data.
+func (ctx *Context) updateDisplayRGBA(fb *risc.Framebuffer, r image.Rectangle) {
 	cw := ctx.config.width
 	ch := ctx.config.height
 
@@ -62,6 +93,8 @@ func (ctx *Context) UpdateDisplay(fb *risc.Framebuffer, r image.Rectangle) {
 	ctx.buf.addUint32(w)
 	ctx.buf.addUint32(h)
 
+	black := rgbaValue(fb.Palette.Black)
+	white := rgbaValue(fb.Palette.White)
 	for line := r.Max.Y; line >= r.Min.Y; line-- {
 		lineStart := line * (cw / 32)
 		for col := r.Min.X; col <= r.Max.X; col++ {
@@ -69,9 +102,9 @@ func (ctx *Context) UpdateDisplay(fb *risc.Framebuffer, r image.Rectangle) {
 			for range 32 {
 				var color uint32
 				if pixels&1 > 0 {
-					color = colorWhite
+					color = white
 				} else {
-					color = colorBlack
+					color = black
 				}
 				ctx.buf.addUint32(color)
 				pixels >>= 1
@@ -81,6 +114,83 @@ func (ctx *Context) UpdateDisplay(fb *risc.Framebuffer, r image.Rectangle) {
 	ctx.Flush()
 }
 
+// updateDisplayPacked sends the framebuffer words as they are, one bit per
+// pixel, along with the two colors. The browser expands the pixels.
+func (ctx *Context) updateDisplayPacked(fb *risc.Framebuffer, r image.Rectangle) {
+	ctx.addPackedHeader(bUpdateDisplayPacked, fb, r)
+	ctx.packWords(&ctx.buf, fb, r)
+	ctx.Flush()
+}
+
+// updateDisplayDeflate sends the packed framebuffer words compressed with
+// the DEFLATE algorithm (RFC 1951).
+func (ctx *Context) updateDisplayDeflate(fb *risc.Framebuffer, r image.Rectangle) {
+	ctx.packed.reset()
+	ctx.packWords(&ctx.packed, fb, r)
+
+	ctx.compressed.Reset()
+	if ctx.deflater == nil {
+		ctx.deflater, _ = flate.NewWriter(&ctx.compressed, flate.BestSpeed)
+	} else {
+		ctx.deflater.Reset(&ctx.compressed)
+	}
+	_, _ = ctx.deflater.Write(ctx.packed.bytes)
+	_ = ctx.deflater.Close()
+
+	ctx.addPackedHeader(bUpdateDisplayDeflate, fb, r)
+	ctx.buf.addUint32(uint32(ctx.compressed.Len()))
+	ctx.buf.bytes = append(ctx.buf.bytes, ctx.compressed.Bytes()...)
+	ctx.Flush()
+}
+
+func (ctx *Context) addPackedHeader(cmd byte, fb *risc.Framebuffer, r image.Rectangle) {
+	ch := ctx.config.height
+	ctx.buf.addByte(cmd)
+	ctx.buf.addUint32(uint32(r.Min.X * 32))
+	ctx.buf.addUint32(uint32(ch - r.Max.Y - 1))
+	ctx.buf.addUint32(uint32((r.Max.X - r.Min.X + 1) * 32))
+	ctx.buf.addUint32(uint32(r.Max.Y - r.Min.Y + 1))
+	ctx.buf.addUint32(rgbaValue(fb.Palette.Black))
+	ctx.buf.addUint32(rgbaValue(fb.Palette.White))
+}
+
+// rgbaValue packs a color as 0xRRGGBBAA.
+func rgbaValue(c color.RGBA) uint32 {
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
+
+// packWords appends the framebuffer words of the damaged rectangle r,
+// from the top line to the bottom line. The least significant bit of
+// a word is the leftmost pixel.
+func (ctx *Context) packWords(buf *buffer, fb *risc.Framebuffer, r image.Rectangle) {
+	cw := ctx.config.width
+	for line := r.Max.Y; line >= r.Min.Y; line-- {
+		lineStart := line * (cw / 32)
+		for col := r.Min.X; col <= r.Max.X; col++ {
+			buf.addUint32(fb.Pix[lineStart+col])
+		}
+	}
+}
+
+// ResizeCanvas changes the size of the canvas in the browser. The
+// content of the canvas is cleared.
+func (ctx *Context) ResizeCanvas(width, height int) {
+	ctx.config.width = width
+	ctx.config.height = height
+	ctx.buf.addByte(bResizeCanvas)
+	ctx.buf.addUint32(uint32(width))
+	ctx.buf.addUint32(uint32(height))
+	ctx.Flush()
+}
+
+// SetLEDs switches the LEDs of the page, see the LEDs option, with
+// bit i of the value for LED i.
+func (ctx *Context) SetLEDs(value byte) {
+	ctx.buf.addByte(bSetLEDs)
+	ctx.buf.addByte(value)
+	ctx.Flush()
+}
+
 func (ctx *Context) ClipboardWriteText(text string) {
 	ctx.buf.addByte(bClipboardWriteText)
 	ctx.buf.addString(text)
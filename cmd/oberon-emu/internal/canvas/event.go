@@ -121,6 +121,10 @@ const (
 type KeyboardEvent struct {
 	// Key represents the key value of the key represented by the event.
 	Key string
+	// Code represents the physical key on the keyboard, named after the
+	// key at that position of a US keyboard, e.g. "KeyZ" for the key
+	// typing 'y' on a German keyboard.
+	Code string
 	modifierKeys
 }
 
@@ -221,6 +225,16 @@ type ClipboardChangeEvent struct{ ClipboardEvent }
 
 func (e ClipboardChangeEvent) mask() eventMask { return maskClipboardChange }
 
+// The ResizeEvent is fired when the browser window is resized, and once
+// after connecting. Width and Height are the size in canvas pixels that
+// would fill the window at the current scale.
+type ResizeEvent struct {
+	Width  int
+	Height int
+}
+
+func (e ResizeEvent) mask() eventMask { return maskResize }
+
 type modifierKeys byte
 
 const (
@@ -276,6 +290,7 @@ const (
 	maskTouchEnd
 	maskTouchCancel
 	maskClipboardChange
+	maskResize
 )
 
 // MouseButtons is a number representing one or more buttons. For more than
@@ -314,6 +329,7 @@ const (
 	evTouchEnd
 	evTouchCancel
 	evClipboardChange
+	evResize
 )
 
 func decodeEvent(p []byte) (Event, error) {
@@ -356,6 +372,8 @@ func decodeEventBuf(buf *buffer) (Event, error) {
 		return TouchCancelEvent{decodeTouchEvent(buf)}, nil
 	case evClipboardChange:
 		return ClipboardChangeEvent{decodeClipboardEvent(buf)}, nil
+	case evResize:
+		return decodeResizeEvent(buf), nil
 	}
 	return nil, errUnknownEventType{unknownType: eventType}
 }
@@ -373,6 +391,7 @@ func decodeKeyboardEvent(buf *buffer) KeyboardEvent {
 	return KeyboardEvent{
 		modifierKeys: modifierKeys(buf.readByte()),
 		Key:          buf.readString(),
+		Code:         buf.readString(),
 	}
 }
 
@@ -425,3 +444,10 @@ type errUnknownEventType struct {
 func (err errUnknownEventType) Error() string {
 	return fmt.Sprintf("unknown event type: %#x", err.unknownType)
 }
+
+func decodeResizeEvent(buf *buffer) ResizeEvent {
+	return ResizeEvent{
+		Width:  int(buf.readUint32()),
+		Height: int(buf.readUint32()),
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 Frederik Zipp. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canvas
+
+import "net/http"
+
+// Option is a functional option for ListenAndServe.
+type Option func(*config)
+
+// TLS serves the page and the WebSocket over HTTPS with the certificate
+// and matching private key from the given PEM files.
+func TLS(certFile, keyFile string) Option {
+	return func(c *config) {
+		c.certFile = certFile
+		c.keyFile = keyFile
+	}
+}
+
+// SelfSignedTLS serves the page and the WebSocket over HTTPS with a
+// self-signed certificate that is generated on startup.
+func SelfSignedTLS() Option {
+	return func(c *config) {
+		c.selfSigned = true
+	}
+}
+
+// Token requires the secret token to access the page and the WebSocket.
+// The browser presents the token once with the "token" URL parameter,
+// e.g. http://localhost:8080/?token=secret, and keeps it in a cookie
+// for subsequent requests.
+func Token(token string) Option {
+	return func(c *config) {
+		c.token = token
+	}
+}
+
+// BasicAuth requires HTTP basic authentication with the given user name
+// and password to access the page and the WebSocket.
+func BasicAuth(user, password string) Option {
+	return func(c *config) {
+		c.user = user
+		c.password = password
+	}
+}
+
+// AllowOrigins accepts WebSocket connections from pages served by the
+// given origins, e.g. "https://example.com", in addition to the server's
+// own origin. This is needed behind a reverse proxy that rewrites the
+// Host header.
+func AllowOrigins(origins ...string) Option {
+	return func(c *config) {
+		c.allowedOrigins = append(c.allowedOrigins, origins...)
+	}
+}
+
+// Zoom scales the canvas on the page by the given factor. It is rounded
+// so that each canvas pixel covers a whole number of device pixels.
+// Without a zoom factor, the canvas is scaled to fit the browser window.
+func Zoom(zoom float64) Option {
+	return func(c *config) {
+		c.zoom = zoom
+	}
+}
+
+// Fullscreen switches the page to fullscreen mode on the first mouse
+// click or key press, since browsers don't allow a page to enter
+// fullscreen mode on its own.
+func Fullscreen() Option {
+	return func(c *config) {
+		c.fullscreen = true
+	}
+}
+
+// FullscreenKeys sets the keys that toggle the fullscreen mode of the
+// page, e.g. "F11" or "Ctrl+Meta+F". The modifiers are Ctrl, Alt, Shift
+// and Meta, the keys are named like the key values of the browser's
+// keyboard events, with single characters in upper case and "Space"
+// for the space bar. The default keys are Alt+Enter and Ctrl+Meta+F.
+// The key events of these keys are not sent to the server.
+func FullscreenKeys(keys ...string) Option {
+	return func(c *config) {
+		c.fullscreenKeys = keys
+	}
+}
+
+// Resizable makes the browser report the size of its window with a
+// ResizeEvent, so that the canvas can be resized to fill it with
+// Context.ResizeCanvas.
+func Resizable() Option {
+	return func(c *config) {
+		c.eventMask |= maskResize
+	}
+}
+
+// LEDs shows a strip of eight LEDs in the bottom right corner of the
+// page, which are switched with Context.SetLEDs.
+func LEDs() Option {
+	return func(c *config) {
+		c.leds = true
+	}
+}
+
+// HandleFunc registers an additional handler function for the given
+// pattern, see http.ServeMux. The handler is protected by the same
+// authentication as the page.
+func HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) Option {
+	return func(c *config) {
+		c.handlers = append(c.handlers, handlerFunc{pattern, handler})
+	}
+}
+
+type handlerFunc struct {
+	pattern string
+	handler func(http.ResponseWriter, *http.Request)
+}
@@ -1,6 +1,7 @@
 package canvas
 
 import (
+	"crypto/tls"
 	_ "embed"
 	"fmt"
 	"html/template"
@@ -8,7 +9,7 @@ import (
 	"image/color"
 	"log"
 	"net/http"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -23,17 +24,36 @@ var (
 	indexHTMLTemplate = template.Must(template.New("index.html.tmpl").Parse(indexHTMLCode))
 )
 
-func ListenAndServe(addr string, run func(*Context), size image.Rectangle) error {
+func ListenAndServe(addr string, run func(*Context), size image.Rectangle, options ...Option) error {
 	config := config{
 		title:               "Project Oberon RISC Emulator",
 		width:               size.Dx(),
 		height:              size.Dy(),
 		backgroundColor:     color.Black,
-		eventMask:           maskMouseMove | maskMouseDown | maskMouseUp | maskKeyDown | maskKeyUp | maskTouchMove | maskClipboardChange,
+		eventMask:           maskMouseMove | maskMouseDown | maskMouseUp | maskKeyDown | maskKeyUp | maskWheel | maskTouchStart | maskTouchMove | maskTouchEnd | maskTouchCancel | maskClipboardChange,
 		cursorDisabled:      true,
 		contextMenuDisabled: true,
+		fullscreenKeys:      []string{"Alt+Enter", "Ctrl+Meta+F"},
 	}
-	return http.ListenAndServe(addr, newServeMux(run, config))
+	for _, opt := range options {
+		opt(&config)
+	}
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: config.authenticate(newServeMux(run, config)),
+	}
+	switch {
+	case config.selfSigned:
+		cert, err := selfSignedCertificate(addr)
+		if err != nil {
+			return fmt.Errorf("could not generate certificate: %w", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		return srv.ListenAndServeTLS("", "")
+	case config.certFile != "":
+		return srv.ListenAndServeTLS(config.certFile, config.keyFile)
+	}
+	return srv.ListenAndServe()
 }
 
 func newServeMux(run func(*Context), config config) *http.ServeMux {
@@ -45,7 +65,15 @@ func newServeMux(run func(*Context), config config) *http.ServeMux {
 	mux.Handle("GET /draw", &drawHandler{
 		config: config,
 		draw:   run,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     config.checkOrigin,
+		},
 	})
+	for _, h := range config.handlers {
+		mux.HandleFunc(h.pattern, h.handler)
+	}
 	return mux
 }
 
@@ -53,9 +81,13 @@ type htmlHandler struct {
 	config config
 }
 
-func (h *htmlHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+func (h *htmlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	drawURL := "draw"
+	if r.URL.Query().Has("view") {
+		drawURL += "?view"
+	}
 	model := map[string]any{
-		"DrawURL":             template.URL("draw"),
+		"DrawURL":             template.URL(drawURL),
 		"Width":               h.config.width,
 		"Height":              h.config.height,
 		"Title":               h.config.title,
@@ -65,6 +97,10 @@ func (h *htmlHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 		"ContextMenuDisabled": h.config.contextMenuDisabled,
 		"FullPage":            h.config.fullPage,
 		"ReconnectInterval":   int64(h.config.reconnectInterval / time.Millisecond),
+		"Zoom":                h.config.zoom,
+		"Fullscreen":          h.config.fullscreen,
+		"FullscreenKeys":      strings.Join(h.config.fullscreenKeys, " "),
+		"LEDs":                h.config.leds,
 	}
 	err := indexHTMLTemplate.Execute(w, model)
 	if err != nil {
@@ -87,62 +123,83 @@ func javaScriptHandler(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-}
-
 type drawHandler struct {
-	config config
-	draw   func(*Context)
+	config   config
+	draw     func(*Context)
+	upgrader websocket.Upgrader
 }
 
 func (h *drawHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
 	events := make(chan Event)
-	defer close(events)
 	draws := make(chan []byte)
-	defer close(draws)
+	drawDone := make(chan struct{})
+	readDone := make(chan struct{})
+	writeDone := make(chan struct{})
 
-	wg := sync.WaitGroup{}
-	wg.Add(2)
-	go readMessages(conn, events, &wg)
-	go writeMessages(conn, draws, &wg)
+	go func() {
+		defer close(readDone)
+		readMessages(conn, events, drawDone)
+	}()
+	go func() {
+		defer close(writeDone)
+		writeMessages(conn, draws)
+	}()
 
-	ctx := newContext(draws, events, h.config)
+	query := r.URL.Query()
+	ctx := newContext(draws, events, h.config, negotiateEncoding(query.Get("encodings")))
+	ctx.viewOnly = query.Has("view")
 	go func() {
-		defer wg.Done()
+		defer close(drawDone)
 		h.draw(ctx)
 	}()
 
-	wg.Wait()
-	wg.Add(1)
-	events <- CloseEvent{}
-	wg.Wait()
+	select {
+	case <-readDone:
+		// The browser disconnected, even if nothing was drawn since.
+		select {
+		case events <- CloseEvent{}:
+		case <-drawDone:
+		}
+		<-drawDone
+	case <-drawDone:
+	}
+	// Nothing is drawn any more: the writer sends the remaining
+	// messages, then closing the connection ends the reader.
+	close(draws)
+	<-writeDone
+	_ = conn.Close()
+	<-readDone
 }
 
-func writeMessages(conn *websocket.Conn, messages <-chan []byte, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for {
-		message := <-messages
+// writeMessages sends the messages until the channel is closed. A failed
+// write closes the connection, which ends the reader.
+func writeMessages(conn *websocket.Conn, messages <-chan []byte) {
+	for message := range messages {
 		err := conn.WriteMessage(websocket.BinaryMessage, message)
 		if err != nil {
+			_ = conn.Close()
 			break
 		}
 	}
+	// Discard messages sent after the connection was closed, so that
+	// a sender updating several contexts does not block on this one.
+	for range messages {
+	}
 }
 
-func readMessages(conn *websocket.Conn, events chan<- Event, wg *sync.WaitGroup) {
-	defer wg.Done()
+// readMessages passes the events from the browser until the connection
+// is closed or the draw function returned.
+func readMessages(conn *websocket.Conn, events chan<- Event, drawDone <-chan struct{}) {
 	for {
 		messageType, p, err := conn.ReadMessage()
 		if err != nil {
-			break
+			return
 		}
 		if messageType != websocket.BinaryMessage {
 			continue
@@ -151,10 +208,40 @@ func readMessages(conn *websocket.Conn, events chan<- Event, wg *sync.WaitGroup)
 		if err != nil {
 			continue
 		}
-		events <- event
+		select {
+		case events <- event:
+		case <-drawDone:
+			return
+		}
 	}
 }
 
+// An encoding is a format of the framebuffer updates sent to the browser.
+type encoding int
+
+const (
+	encodingRGBA    encoding = iota // 32-bit RGBA per pixel, always supported
+	encodingPacked                  // 1 bit per pixel
+	encodingDeflate                 // 1 bit per pixel, DEFLATE-compressed
+)
+
+var encodingNames = map[string]encoding{
+	"packed":  encodingPacked,
+	"deflate": encodingDeflate,
+}
+
+// negotiateEncoding selects the most compact encoding from the
+// comma-separated list of encodings that the browser supports.
+func negotiateEncoding(supported string) encoding {
+	best := encodingRGBA
+	for _, name := range strings.Split(supported, ",") {
+		if enc, ok := encodingNames[strings.TrimSpace(name)]; ok && enc > best {
+			best = enc
+		}
+	}
+	return best
+}
+
 type config struct {
 	title               string
 	width               int
@@ -165,4 +252,18 @@ type config struct {
 	contextMenuDisabled bool
 	fullPage            bool
 	reconnectInterval   time.Duration
+	zoom                float64
+	fullscreen          bool
+	fullscreenKeys      []string
+	leds                bool
+
+	certFile       string
+	keyFile        string
+	selfSigned     bool
+	token          string
+	user           string
+	password       string
+	allowedOrigins []string
+
+	handlers []handlerFunc
 }
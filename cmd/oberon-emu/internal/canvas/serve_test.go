@@ -0,0 +1,119 @@
+// Copyright 2020 Frederik Zipp. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canvas
+
+import (
+	"image"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// seats hands an input seat to the first connected context and frees it
+// when the context's connection is closed, like the shared session of
+// the emulator.
+type seats struct {
+	mu     sync.Mutex
+	holder *Context
+	joined chan *Context
+}
+
+func (s *seats) serve(ctx *Context) {
+	s.mu.Lock()
+	if s.holder == nil {
+		s.holder = ctx
+	}
+	s.mu.Unlock()
+	s.joined <- ctx
+
+	for event := range ctx.Events() {
+		if _, ok := event.(CloseEvent); ok {
+			break
+		}
+	}
+	s.mu.Lock()
+	if s.holder == ctx {
+		s.holder = nil
+	}
+	s.mu.Unlock()
+}
+
+func (s *seats) seatHolder() *Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.holder
+}
+
+func startTestServer(t *testing.T, run func(*Context)) string {
+	t.Helper()
+	config := config{width: 64, height: 32}
+	srv := httptest.NewServer(newServeMux(run, config))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/draw"
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	return conn
+}
+
+func TestIdleSeatHolderDisconnect(t *testing.T) {
+	s := &seats{joined: make(chan *Context)}
+	url := startTestServer(t, s.serve)
+
+	// The first browser takes the seat and neither sends events nor
+	// gets any updates before it disconnects.
+	first := dial(t, url)
+	ctx := <-s.joined
+	if s.seatHolder() != ctx {
+		t.Fatal("first connection did not take the seat")
+	}
+	_ = first.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.seatHolder() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("seat still held after the holder disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	second := dial(t, url)
+	defer second.Close()
+	if ctx := <-s.joined; s.seatHolder() != ctx {
+		t.Error("seat not passed on to the next connection")
+	}
+}
+
+func TestDrawReturnCloses(t *testing.T) {
+	url := startTestServer(t, func(ctx *Context) {
+		ctx.UpdateDisplay(nil, image.Rectangle{Min: image.Pt(1, 1)}) // empty
+		ctx.SetLEDs(0x81)
+	})
+
+	conn := dial(t, url)
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, p, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if want := []byte{bSetLEDs, 0x81}; string(p) != string(want) {
+		t.Errorf("message: got % X, want % X", p, want)
+	}
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("connection still open after the draw function returned")
+	} else if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+		t.Error("connection not closed after the draw function returned")
+	}
+}
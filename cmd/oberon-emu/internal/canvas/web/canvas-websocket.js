@@ -10,7 +10,8 @@ document.addEventListener("DOMContentLoaded", function () {
         const canvas = canvases[i];
         const config = configFrom(canvas.dataset);
         if (config.drawUrl) {
-            webSocketCanvas(canvas, config);
+            const layout = fitCanvas(canvas, config);
+            webSocketCanvas(canvas, config, layout);
             if (config.contextMenuDisabled) {
                 disableContextMenu(canvas);
             }
@@ -34,10 +35,117 @@ document.addEventListener("DOMContentLoaded", function () {
             drawUrl: absoluteWebSocketUrl(dataset["websocketDrawUrl"]),
             eventMask: parseInt(dataset["websocketEventMask"], 10) || 0,
             reconnectInterval: parseInt(dataset["websocketReconnectInterval"], 10) || 0,
-            contextMenuDisabled: (dataset["disableContextMenu"] === "true")
+            contextMenuDisabled: (dataset["disableContextMenu"] === "true"),
+            zoom: parseFloat(dataset["zoom"]) || 0,
+            fullscreen: (dataset["fullscreen"] === "true"),
+            fullscreenKeys: parseKeys(dataset["fullscreenKeys"] || "")
         };
     }
 
+    // parseKeys parses a space-separated list of keys with modifiers,
+    // e.g. "F11 Alt+Enter".
+    function parseKeys(s) {
+        return s.split(" ").filter(Boolean).map(function (chord) {
+            const parts = chord.split("+");
+            const mods = parts.slice(0, -1);
+            return {
+                key: parts[parts.length - 1],
+                ctrlKey: mods.includes("Ctrl"),
+                altKey: mods.includes("Alt"),
+                shiftKey: mods.includes("Shift"),
+                metaKey: mods.includes("Meta")
+            };
+        });
+    }
+
+    // fitCanvas sizes the canvas on the page. Each canvas pixel covers a
+    // whole number of device pixels, so that the pixels stay crisp. With
+    // a zoom factor the canvas is scaled by it, otherwise and in
+    // fullscreen mode it is scaled as large as the window allows.
+    // It returns the function that sizes the canvas again.
+    function fitCanvas(canvas, config) {
+        function layout() {
+            const ratio = window.devicePixelRatio || 1;
+            let scale; // device pixels per canvas pixel
+            if (config.zoom > 0 && !document.fullscreenElement) {
+                scale = zoomScale(config);
+            } else {
+                scale = Math.min(
+                    window.innerWidth * ratio / canvas.width,
+                    window.innerHeight * ratio / canvas.height);
+                if (scale >= 1) {
+                    scale = Math.floor(scale);
+                }
+            }
+            canvas.style.width = (canvas.width * scale / ratio) + "px";
+            canvas.style.height = (canvas.height * scale / ratio) + "px";
+        }
+
+        // The device pixel ratio changes with the browser zoom
+        // and when the window moves to another screen.
+        function watchPixelRatio() {
+            const query = window.matchMedia("(resolution: " + window.devicePixelRatio + "dppx)");
+            query.addEventListener("change", function () {
+                layout();
+                watchPixelRatio();
+            }, {once: true});
+        }
+
+        layout();
+        watchPixelRatio();
+        window.addEventListener("resize", layout);
+        document.addEventListener("fullscreenchange", layout);
+
+        if (config.fullscreen) {
+            // Browsers only allow entering fullscreen mode
+            // in response to a user action.
+            const enter = function () {
+                canvas.removeEventListener("mousedown", enter);
+                document.removeEventListener("keydown", enter);
+                if (!document.fullscreenElement) {
+                    toggleFullscreen();
+                }
+            };
+            canvas.addEventListener("mousedown", enter);
+            document.addEventListener("keydown", enter);
+        }
+        return layout;
+    }
+
+    // zoomScale returns the number of device pixels per canvas pixel
+    // for the zoom factor, or for a zoom factor of 1 without one.
+    function zoomScale(config) {
+        const ratio = window.devicePixelRatio || 1;
+        const zoom = (config.zoom > 0 && !document.fullscreenElement) ? config.zoom : 1;
+        return Math.max(Math.round(zoom * ratio), 1);
+    }
+
+    function toggleFullscreen() {
+        if (document.fullscreenElement) {
+            document.exitFullscreen();
+        } else if (document.documentElement.requestFullscreen) {
+            document.documentElement.requestFullscreen();
+        }
+    }
+
+    // isFullscreenShortcut reports whether a key event toggles the
+    // fullscreen mode. Additional modifiers don't prevent a match.
+    function isFullscreenShortcut(event, keys) {
+        let key = event.key;
+        if (key === " ") {
+            key = "Space";
+        } else if (key.length === 1) {
+            key = key.toUpperCase();
+        }
+        return keys.some(function (k) {
+            return k.key === key &&
+                (!k.ctrlKey || event.ctrlKey) &&
+                (!k.altKey || event.altKey) &&
+                (!k.shiftKey || event.shiftKey) &&
+                (!k.metaKey || event.metaKey);
+        });
+    }
+
     function absoluteWebSocketUrl(url) {
         if (!url) {
             return null;
@@ -50,13 +158,14 @@ document.addEventListener("DOMContentLoaded", function () {
         return wsUrl.href;
     }
 
-    function webSocketCanvas(canvas, config) {
+    function webSocketCanvas(canvas, config, layout) {
         const ctx = canvas.getContext("2d");
-        const webSocket = new WebSocket(config.drawUrl);
+        const webSocket = new WebSocket(drawUrlWithEncodings(config.drawUrl));
         let handlers = {};
+        let drawing = Promise.resolve();
         webSocket.binaryType = "arraybuffer";
         webSocket.addEventListener("open", function () {
-            handlers = addEventListeners(canvas, config.eventMask, webSocket);
+            handlers = addEventListeners(canvas, config, webSocket);
         });
         webSocket.addEventListener("error", function () {
             webSocket.close();
@@ -67,15 +176,36 @@ document.addEventListener("DOMContentLoaded", function () {
                 return;
             }
             setTimeout(function () {
-                webSocketCanvas(canvas, config);
+                webSocketCanvas(canvas, config, layout);
             }, config.reconnectInterval);
         });
         webSocket.addEventListener("message", function (event) {
-            draw(ctx, new DataView(event.data));
+            // Compressed updates are decoded asynchronously,
+            // so the messages are drawn in a chain to keep their order.
+            // A message that fails to draw must not stop the chain.
+            const data = new DataView(event.data);
+            drawing = drawing.then(function () {
+                return draw(ctx, data, layout);
+            }).catch(function (e) {
+                console.error(e);
+            });
         });
     }
 
-    function addEventListeners(canvas, eventMask, webSocket) {
+    // drawUrlWithEncodings tells the server which framebuffer update
+    // encodings the browser supports.
+    function drawUrlWithEncodings(drawUrl) {
+        const url = new URL(drawUrl);
+        const encodings = ["packed"];
+        if (typeof DecompressionStream !== "undefined") {
+            encodings.unshift("deflate");
+        }
+        url.searchParams.set("encodings", encodings.join(","));
+        return url.href;
+    }
+
+    function addEventListeners(canvas, config, webSocket) {
+        const eventMask = config.eventMask;
         const handlers = {};
 
         if (eventMask & 1) {
@@ -120,13 +250,17 @@ document.addEventListener("DOMContentLoaded", function () {
         if (eventMask & 8192) {
             pollClipboardChange(sendClipboardEvent(14));
         }
+        if (eventMask & 16384) {
+            handlers["resize"] = sendResizeEvent(15);
+        }
 
         Object.keys(handlers).forEach(function (type) {
             const target = targetFor(type, canvas);
             target.addEventListener(type, handlers[type], {passive: false});
         });
-
-        const rect = canvas.getBoundingClientRect();
+        if (handlers["resize"]) {
+            handlers["resize"]();
+        }
 
         const mouseMoveThreshold = 25;
         let lastMouseMoveTime = -1;
@@ -163,13 +297,27 @@ document.addEventListener("DOMContentLoaded", function () {
         }
 
         function setMouseEvent(dataView, eventType, event) {
+            const pos = canvasPosition(event);
             dataView.setUint8(0, eventType);
             dataView.setUint8(1, event.buttons);
-            dataView.setUint32(2, ((event.clientX - rect.left) / canvas.offsetWidth) * canvas.width);
-            dataView.setUint32(6, ((event.clientY - rect.top) / canvas.offsetHeight) * canvas.height);
+            dataView.setUint32(2, pos.x);
+            dataView.setUint32(6, pos.y);
             dataView.setUint8(10, encodeModifierKeys(event));
         }
 
+        // canvasPosition converts the client coordinates of an event
+        // to the canvas pixel under it. The canvas may be scaled and
+        // moved around on the page since the listeners were added.
+        function canvasPosition(event) {
+            const rect = canvas.getBoundingClientRect();
+            const x = Math.floor((event.clientX - rect.left) / rect.width * canvas.width);
+            const y = Math.floor((event.clientY - rect.top) / rect.height * canvas.height);
+            return {
+                x: Math.min(Math.max(x, 0), canvas.width - 1),
+                y: Math.min(Math.max(y, 0), canvas.height - 1)
+            };
+        }
+
         function sendTouchEvent(eventType) {
             return function (event) {
                 event.preventDefault();
@@ -197,11 +345,12 @@ document.addEventListener("DOMContentLoaded", function () {
             offset++;
             for (let i = 0; i < len; i++) {
                 const touch = touches[i];
+                const pos = canvasPosition(touch);
                 dataView.setUint32(offset, touch.identifier);
                 offset += 4;
-                dataView.setUint32(offset, ((touch.clientX - rect.left) / canvas.offsetWidth) * canvas.width);
+                dataView.setUint32(offset, pos.x);
                 offset += 4;
-                dataView.setUint32(offset, ((touch.clientY - rect.top) / canvas.offsetHeight) * canvas.height);
+                dataView.setUint32(offset, pos.y);
                 offset += 4;
             }
             return offset;
@@ -210,8 +359,15 @@ document.addEventListener("DOMContentLoaded", function () {
         function sendKeyEvent(eventType) {
             return function (event) {
                 event.preventDefault();
+                if (isFullscreenShortcut(event, config.fullscreenKeys)) {
+                    if (eventType === 4) {
+                        toggleFullscreen();
+                    }
+                    return;
+                }
                 const keyBytes = new TextEncoder().encode(event.key);
-                const eventMessage = new ArrayBuffer(6 + keyBytes.byteLength);
+                const codeBytes = new TextEncoder().encode(event.code);
+                const eventMessage = new ArrayBuffer(10 + keyBytes.byteLength + codeBytes.byteLength);
                 const data = new DataView(eventMessage);
                 data.setUint8(0, eventType);
                 data.setUint8(1, encodeModifierKeys(event));
@@ -219,10 +375,34 @@ document.addEventListener("DOMContentLoaded", function () {
                 for (let i = 0; i < keyBytes.length; i++) {
                     data.setUint8(6 + i, keyBytes[i]);
                 }
+                const offset = 6 + keyBytes.byteLength;
+                data.setUint32(offset, codeBytes.byteLength);
+                for (let i = 0; i < codeBytes.length; i++) {
+                    data.setUint8(offset + 4 + i, codeBytes[i]);
+                }
                 webSocket.send(eventMessage);
             };
         }
 
+        // sendResizeEvent reports the canvas size that fills the window
+        // at the current scale, once the window stopped changing its size.
+        function sendResizeEvent(eventType) {
+            let timeout = null;
+            return function () {
+                clearTimeout(timeout);
+                timeout = setTimeout(function () {
+                    const ratio = window.devicePixelRatio || 1;
+                    const scale = zoomScale(config);
+                    const eventMessage = new ArrayBuffer(9);
+                    const data = new DataView(eventMessage);
+                    data.setUint8(0, eventType);
+                    data.setUint32(1, Math.floor(window.innerWidth * ratio / scale));
+                    data.setUint32(5, Math.floor(window.innerHeight * ratio / scale));
+                    webSocket.send(eventMessage);
+                }, 250);
+            };
+        }
+
         function sendClipboardEvent(eventType) {
             return function (event) {
                 const dataBytes = new TextEncoder().encode(event.data);
@@ -248,6 +428,9 @@ document.addEventListener("DOMContentLoaded", function () {
     }
 
     function targetFor(eventType, canvas) {
+        if (eventType === "resize") {
+            return window;
+        }
         if ((eventType.indexOf("key") !== 0) && (eventType.indexOf("composition") !== 0)) {
             return canvas;
         }
@@ -277,7 +460,7 @@ document.addEventListener("DOMContentLoaded", function () {
         return modifiers;
     }
 
-    function draw(ctx, data) {
+    function draw(ctx, data, layout) {
         switch (data.getUint8(0)) {
             case 1:
                 const x = data.getUint32(1);
@@ -295,9 +478,60 @@ document.addEventListener("DOMContentLoaded", function () {
                 const text = getString(data, 1);
                 navigator.clipboard.writeText(text.value);
                 return 1 + text.byteLen;
+            case 3:
+                drawPacked(ctx, data, new DataView(data.buffer, data.byteOffset + 25));
+                return;
+            case 4:
+                const compressedLen = data.getUint32(25);
+                const compressed = new Uint8Array(data.buffer, data.byteOffset + 29, compressedLen);
+                const stream = new Blob([compressed]).stream()
+                    .pipeThrough(new DecompressionStream("deflate-raw"));
+                return new Response(stream).arrayBuffer().then(function (words) {
+                    drawPacked(ctx, data, new DataView(words));
+                });
+            case 5:
+                ctx.canvas.width = data.getUint32(1);
+                ctx.canvas.height = data.getUint32(5);
+                layout();
+                return;
+            case 6:
+                showLEDs(data.getUint8(1));
+                return;
         }
         return 1;
     }
+
+    // showLEDs switches the LEDs of the page, with bit i of the value
+    // for LED i.
+    function showLEDs(value) {
+        const leds = document.querySelectorAll(".led");
+        for (let i = 0; i < leds.length; i++) {
+            const n = parseInt(leds[i].dataset["led"], 10);
+            leds[i].classList.toggle("on", (value & (1 << n)) !== 0);
+        }
+    }
+
+    // drawPacked expands framebuffer words with one bit per pixel,
+    // least significant bit first, into the two colors from the header.
+    function drawPacked(ctx, header, words) {
+        const x = header.getUint32(1);
+        const y = header.getUint32(5);
+        const width = header.getUint32(9);
+        const height = header.getUint32(13);
+        const colors = [header.getUint32(17), header.getUint32(21)];
+        const imageData = new ImageData(width, height);
+        const pixels = new DataView(imageData.data.buffer);
+        let offset = 0;
+        for (let i = 0; i < width * height / 32; i++) {
+            let word = words.getUint32(i * 4);
+            for (let bit = 0; bit < 32; bit++) {
+                pixels.setUint32(offset, colors[word & 1]);
+                word >>>= 1;
+                offset += 4;
+            }
+        }
+        ctx.putImageData(imageData, x, y);
+    }
 });
 
 function getString(data, offset) {
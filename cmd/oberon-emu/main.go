@@ -8,182 +8,304 @@
 package main
 
 import (
-	"errors"
 	"flag"
 	"fmt"
+	"image"
 	"log"
+	neturl "net/url"
 	"os"
 	"os/exec"
 	"runtime"
 	"time"
 
+	"github.com/fzipp/oberon/clipboard"
+	"github.com/fzipp/oberon/emulator"
+	"github.com/fzipp/oberon/keybind"
+	"github.com/fzipp/oberon/ps2"
 	"github.com/fzipp/oberon/risc"
-	"github.com/fzipp/oberon/serial"
-	"github.com/fzipp/oberon/spi"
 
 	"github.com/fzipp/oberon/cmd/oberon-emu/internal/canvas"
 )
 
-const (
-	cpuHz = 25000000
-	fps   = 60
-)
-
 func main() {
 	opt, err := optionsFromFlags()
 	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	url := httpLink(opt.http)
+	url := httpLink(opt.http, opt.tlsCert != "" || opt.tlsSelfSigned)
+	if opt.token != "" {
+		url += "/?token=" + neturl.QueryEscape(opt.token)
+	}
 	if opt.open && startBrowser(url) {
 		fmt.Println("Listening on " + url)
 	} else {
 		fmt.Println("Visit " + url + " in a web browser")
 	}
 
-	err = canvas.ListenAndServe(opt.http, func(ctx *canvas.Context) {
+	serve := func(ctx *canvas.Context) {
 		run(ctx, opt)
-	}, opt.sizeRect)
+	}
+	options := serverOptions(opt)
+	if opt.shared {
+		s, err := startSession(opt)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		serve = s.serve
+		options = append(options, canvas.HandleFunc("GET /screenshot.png", s.serveScreenshot))
+	}
+
+	err = canvas.ListenAndServe(opt.http, serve, opt.machine.ScreenBounds(), options...)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
 func run(ctx *canvas.Context, opt *options) {
-	r := risc.New()
-	r.SetSerial(&serial.PCLink{})
-	clipboard := &Clipboard{ctx: ctx}
-	r.SetClipboard(clipboard)
-
-	if opt.leds {
-		r.SetLEDs(&ConsoleLEDs{})
-	}
-
-	if opt.bootFromSerial {
-		r.SetSwitches(1)
-	}
-
-	if opt.mem > 0 || opt.size != "" {
-		r.ConfigureMemory(opt.mem, opt.sizeRect.Dx(), opt.sizeRect.Dy())
-	}
-
-	disk, err := spi.NewDisk(opt.diskImageFile)
+	// The page polls its clipboard and reports changes of the text with
+	// ClipboardChangeEvents; text put on the clipboard by Oberon is
+	// written to the clipboard of the page.
+	host := clipboard.NewMemory(ctx.ClipboardWriteText)
+	c := opt.machine
+	c.Clipboard = clipboard.New(host)
+	m, err := emulator.New(c)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "can't use disk image: %s", err)
+		_, _ = fmt.Fprintln(os.Stderr, err)
 		return
 	}
-	r.SetSPI(1, disk)
+	defer closeMachine(m)
 
-	if opt.serialIn != "" || opt.serialOut != "" {
-		raw, err := serial.Open(opt.serialIn, opt.serialOut)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "can't open serial I/O: %s", err)
-			return
-		}
-		r.SetSerial(raw)
+	b := &browser{
+		ctx:       ctx,
+		clipboard: host,
+		screen:    newScreenCapture(m.Framebuffer(), opt.captureDir),
+		keys:      keybind.NewKeyboard(opt.keys),
+		layout:    opt.layout,
+		size:      m.Framebuffer().Rect,
+		showLEDs:  opt.showLEDs,
 	}
+	defer b.screen.stopRecording()
+	emulator.Run(m, b)
+}
 
-	fb := r.Framebuffer()
+// A browser is the frontend of a machine in a single browser tab.
+type browser struct {
+	ctx       *canvas.Context
+	clipboard *clipboard.Memory
+	screen    *screenCapture
+	gestures  gestures
+	keys      *keybind.Keyboard
+	layout    *ps2.Layout // keyboard layout in character mode, or nil
+	size      image.Rectangle
+	showLEDs  bool
+	leds      uint8 // LED state shown by the page
+}
 
-	riscStart := getTicks()
+func (b *browser) Input(m *emulator.Machine) bool {
+	if leds := m.LEDs(); b.showLEDs && leds != b.leds {
+		b.leds = leds
+		b.ctx.SetLEDs(leds)
+	}
 	for {
-		frameStart := getTicks()
 		select {
-		case event := <-ctx.Events():
+		case event := <-b.ctx.Events():
 			if _, ok := event.(canvas.CloseEvent); ok {
-				return
+				return false
 			}
-			handleEvent(event, r, ctx, clipboard)
+			handleEvent(event, m, b.clipboard, b.screen, &b.gestures, b.keys, b.layout)
 		default:
-			r.SetTime(uint32(frameStart - riscStart))
-			err := r.Run(cpuHz / fps)
-			if err != nil {
-				var riscErr *risc.Error
-				if errors.As(err, &riscErr) {
-					_, _ = fmt.Fprintf(os.Stderr, "%s (PC=0x%08X)\n", riscErr, riscErr.PC)
-				} else {
-					_, _ = fmt.Fprintln(os.Stderr, err)
-				}
-			}
+			b.gestures.tick(m, time.Now())
+			return true
+		}
+	}
+}
 
-			ctx.UpdateDisplay(fb, r.GetFramebufferDamageAndReset())
+func (b *browser) Display(fb *risc.Framebuffer, damage []image.Rectangle) {
+	if fb.Rect != b.size {
+		b.size = fb.Rect
+		b.ctx.ResizeCanvas(b.size.Dx(), b.size.Dy())
+	}
+	b.screen.update(damage)
+	for _, d := range damage {
+		b.ctx.UpdateDisplay(fb, d)
+	}
+}
 
-			frameEnd := getTicks()
-			delay := frameStart + 1000/fps - frameEnd
-			time.Sleep(time.Duration(delay) * time.Millisecond)
-		}
+// closeMachine closes the machine and reports the errors, e.g. if the
+// execution profile can't be written.
+func closeMachine(m *emulator.Machine) {
+	if err := m.Close(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
 	}
 }
 
-func handleEvent(e canvas.Event, r *risc.RISC, ctx *canvas.Context, clipboard *Clipboard) {
+func handleEvent(e canvas.Event, m *emulator.Machine, clip *clipboard.Memory, screen *screenCapture, g *gestures, keys *keybind.Keyboard, layout *ps2.Layout) {
+	// The canvas has the size of the framebuffer.
+	height := m.Framebuffer().Rect.Dy()
 	switch ev := e.(type) {
 	case canvas.MouseMoveEvent:
-		r.MouseMoved(ev.X, ctx.CanvasHeight()-ev.Y)
+		m.MouseMoved(ev.X, height-ev.Y-1)
 	case canvas.MouseDownEvent:
-		if ev.AltKey() {
-			r.MouseButton(2, true)
-			break
-		}
-		if ev.MetaKey() {
-			r.MouseButton(3, true)
+		if b := modifierButton(keys.Bindings(), modifiers(ev.MouseEvent)); b != 0 {
+			m.MouseButton(b, true)
 			break
 		}
 		if ev.Buttons&canvas.ButtonPrimary > 0 {
-			r.MouseButton(1, true)
+			m.MouseButton(1, true)
 		}
 		if ev.Buttons&canvas.ButtonAuxiliary > 0 {
-			r.MouseButton(2, true)
+			m.MouseButton(2, true)
 		}
 		if ev.Buttons&canvas.ButtonSecondary > 0 {
-			r.MouseButton(3, true)
+			m.MouseButton(3, true)
 		}
 	case canvas.MouseUpEvent:
-		r.MouseButton(1, false)
-		r.MouseButton(2, false)
-		r.MouseButton(3, false)
+		m.MouseButton(1, false)
+		m.MouseButton(2, false)
+		m.MouseButton(3, false)
 	case canvas.KeyDownEvent:
-		if ev.Key == "Control" {
-			r.MouseButton(1, true)
-			return
-		}
-		if ev.Key == "Alt" {
-			r.MouseButton(2, true)
-			return
-		}
-		if ev.Key == "Meta" {
-			r.MouseButton(3, true)
-			return
+		action := keys.Press(keybind.KeyName(ev.Key), modifiers(ev.KeyboardEvent))
+		switch action {
+		case keybind.None:
+			m.KeyboardInput(ps2Encode(ev.KeyboardEvent, layout, true))
+		case keybind.Reset:
+			m.Reset()
+		case keybind.Screenshot:
+			screen.screenshot()
+		case keybind.Record:
+			screen.toggleRecording()
+		case keybind.Paste:
+			if m.Typing() {
+				m.StopTyping()
+			} else {
+				text, _ := clip.Text()
+				m.Type(text, layout)
+			}
+		case keybind.Mouse1, keybind.Mouse2, keybind.Mouse3:
+			m.MouseButton(action.MouseButton(), true)
 		}
-		r.KeyboardInput(ps2Encode(ev.KeyboardEvent, true))
+		// The page toggles the fullscreen mode itself, and a browser
+		// tab can't quit.
 	case canvas.KeyUpEvent:
-		if ev.Key == "Control" {
-			r.MouseButton(1, false)
-			return
+		action := keys.Release(keybind.KeyName(ev.Key))
+		if action == keybind.None {
+			m.KeyboardInput(ps2Encode(ev.KeyboardEvent, layout, false))
+		} else if button := action.MouseButton(); button != 0 {
+			m.MouseButton(button, false)
 		}
-		if ev.Key == "Alt" {
-			r.MouseButton(2, false)
-			return
+	case canvas.WheelEvent:
+		g.wheelEvent(m, ev)
+	case canvas.TouchStartEvent:
+		g.touchStart(m, height, ev.Touches, time.Now())
+	case canvas.TouchMoveEvent:
+		g.touchMove(m, height, ev.Touches, time.Now())
+	case canvas.TouchEndEvent:
+		g.touchEnd(m, ev.Touches, time.Now(), false)
+	case canvas.TouchCancelEvent:
+		g.touchEnd(m, ev.Touches, time.Now(), true)
+	case canvas.ClipboardChangeEvent:
+		clip.Update(ev.Data)
+	case canvas.ResizeEvent:
+		err := m.ResizeDisplay(ev.Width, ev.Height)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
 		}
-		if ev.Key == "Meta" {
-			r.MouseButton(3, false)
-			return
+	}
+}
+
+// modifiers returns the modifier keys that were active during a key
+// event.
+// modifierState is the state of the modifier keys of a keyboard or
+// mouse event.
+type modifierState interface {
+	CtrlKey() bool
+	AltKey() bool
+	ShiftKey() bool
+	MetaKey() bool
+}
+
+func modifiers(e modifierState) keybind.Modifiers {
+	var mods keybind.Modifiers
+	if e.CtrlKey() {
+		mods |= keybind.Ctrl
+	}
+	if e.AltKey() {
+		mods |= keybind.Alt
+	}
+	if e.ShiftKey() {
+		mods |= keybind.Shift
+	}
+	if e.MetaKey() {
+		mods |= keybind.Meta
+	}
+	return mods
+}
+
+// modifierButton returns the middle or right mouse button if a modifier
+// key bound to it is pressed, or 0. A click with such a key, like
+// Alt+click by default, presses only the button of the key, so that
+// a one-button mouse can click all buttons.
+func modifierButton(b *keybind.Bindings, mods keybind.Modifiers) int {
+	for _, a := range []keybind.Action{keybind.Mouse2, keybind.Mouse3} {
+		for _, c := range b.Keys(a) {
+			if c.Mods == 0 && mods&keybind.Modifier(c.Key) != 0 {
+				return a.MouseButton()
+			}
 		}
-		r.KeyboardInput(ps2Encode(ev.KeyboardEvent, false))
-	case canvas.ClipboardChangeEvent:
-		clipboard.setText(ev.Data)
 	}
+	return 0
 }
 
-func getTicks() int64 {
-	return time.Now().UnixNano() / int64(time.Millisecond)
+// serverOptions returns the display and security options of the web
+// server.
+func serverOptions(opt *options) []canvas.Option {
+	var options []canvas.Option
+	if opt.zoom > 0 {
+		options = append(options, canvas.Zoom(opt.zoom))
+	}
+	if opt.fullscreen {
+		options = append(options, canvas.Fullscreen())
+	}
+	var fullscreenKeys []string
+	for _, c := range opt.keys.Keys(keybind.Fullscreen) {
+		fullscreenKeys = append(fullscreenKeys, c.String())
+	}
+	options = append(options, canvas.FullscreenKeys(fullscreenKeys...))
+	if opt.machine.Resizable {
+		options = append(options, canvas.Resizable())
+	}
+	if opt.showLEDs {
+		options = append(options, canvas.LEDs())
+	}
+	if opt.tlsCert != "" {
+		options = append(options, canvas.TLS(opt.tlsCert, opt.tlsKey))
+	}
+	if opt.tlsSelfSigned {
+		options = append(options, canvas.SelfSignedTLS())
+	}
+	if opt.token != "" {
+		options = append(options, canvas.Token(opt.token))
+	}
+	if opt.user != "" {
+		options = append(options, canvas.BasicAuth(opt.user, opt.password))
+	}
+	if len(opt.allowedOrigins) > 0 {
+		options = append(options, canvas.AllowOrigins(opt.allowedOrigins...))
+	}
+	return options
 }
 
-func httpLink(addr string) string {
+func httpLink(addr string, secure bool) string {
 	if addr[0] == ':' {
 		addr = "localhost" + addr
 	}
+	if secure {
+		return "https://" + addr
+	}
 	return "http://" + addr
 }
 
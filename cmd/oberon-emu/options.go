@@ -7,90 +7,116 @@ package main
 import (
 	"errors"
 	"flag"
-	"fmt"
-	"image"
+	"os"
+	"strings"
 
-	"github.com/fzipp/oberon/risc"
-)
-
-const (
-	maxHeight = 2048
-	maxWidth  = 2048
+	"github.com/fzipp/oberon/emulator"
+	"github.com/fzipp/oberon/keybind"
+	"github.com/fzipp/oberon/ps2"
 )
 
 type options struct {
+	machine        emulator.Config
+	keys           *keybind.Bindings
+	layout         *ps2.Layout
 	http           string
 	open           bool
+	shared         bool
 	fullscreen     bool
 	zoom           float64
-	leds           bool
-	mem            int
-	size           string
-	sizeRect       image.Rectangle
-	bootFromSerial bool
-	serialIn       string
-	serialOut      string
-	diskImageFile  string
+	showLEDs       bool
+	captureDir     string
+	tlsCert        string
+	tlsKey         string
+	tlsSelfSigned  bool
+	token          string
+	user           string
+	password       string
+	allowedOrigins []string
 }
 
 func optionsFromFlags() (*options, error) {
-	http := flag.String("http", ":8080", "HTTP service address (e.g., '127.0.0.1:8080' or just ':8080')")
+	var machine emulator.Config
+	machine.RegisterFlags(flag.CommandLine)
+	http := flag.String("http", "localhost:8080", "HTTP service address (e.g., '127.0.0.1:8080' or ':8080' for all interfaces)")
 	fullscreen := flag.Bool("fullscreen", false, "Start the emulator in full screen mode")
 	zoom := flag.Float64("zoom", 0, "Scale the display in windowed mode by the given factor")
-	leds := flag.Bool("leds", false, "Log LED state on stdout")
-	mem := flag.Int("mem", 0, "Set memory size in `MEGS`")
-	size := flag.String("size", "", "Set framebuffer size to `WIDTHxHEIGHT`")
-	bootFromSerial := flag.Bool("boot-from-serial", false, "Boot from serial line (disk image not required)")
-	serialIn := flag.String("serial-in", "", "Read serial input from `FILE`")
-	serialOut := flag.String("serial-out", "", "Read serial input from `FILE`")
+	flag.BoolVar(&machine.Resizable, "resize", false, "Resize the Oberon display with the browser window (requires a display driver that supports it)")
+	showLEDs := flag.Bool("show-leds", false, "Show the LEDs of the machine in the corner of the page")
+	captureDir := flag.String("capture-dir", ".", "Save screenshots and recordings in `DIR`")
+	keysFile := flag.String("keys", keybind.DefaultFile(), "Read the key bindings from `FILE`")
+	layoutName := flag.String("layout", "", "Pass the typed characters instead of the key positions, with the keyboard layout `NAME` of the Oberon keyboard driver: us, de or ch")
 	open := flag.Bool("open", true, "Try to open browser")
+	shared := flag.Bool("shared", false, "Share one persistent machine between all browser connections")
+	tlsCert := flag.String("tls-cert", "", "Serve HTTPS with the certificate from PEM `FILE` (requires -tls-key)")
+	tlsKey := flag.String("tls-key", "", "Serve HTTPS with the private key from PEM `FILE` (requires -tls-cert)")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "Serve HTTPS with a generated self-signed certificate")
+	token := flag.String("token", "", "Require the secret `TOKEN` to access the emulator (default $OBERON_EMU_TOKEN)")
+	basicAuth := flag.String("basic-auth", "", "Require HTTP basic authentication with `USER:PASSWORD` (default $OBERON_EMU_BASIC_AUTH)")
+	var allowedOrigins []string
+	flag.Func("allow-origin", "Accept WebSocket connections from pages of `ORIGIN`, e.g. behind a reverse proxy", func(s string) error {
+		allowedOrigins = append(allowedOrigins, s)
+		return nil
+	})
 
 	flag.Parse()
 
-	diskImageFile := ""
-	if !*bootFromSerial {
-		if flag.NArg() < 1 {
-			return nil, errors.New("missing argument")
-		}
-		diskImageFile = flag.Arg(0)
+	if err := machine.SetArgs(flag.Args()); err != nil {
+		return nil, err
 	}
 
-	sizeRect := image.Rect(0, 0, risc.FramebufferWidth, risc.FramebufferHeight)
+	keys, err := keybind.Load(*keysFile)
+	if err != nil {
+		return nil, err
+	}
 
-	if *size != "" {
-		var w, h int
-		_, err := fmt.Sscanf(*size, "%dx%d", &w, &h)
+	var layout *ps2.Layout
+	if *layoutName != "" {
+		layout, err = ps2.LayoutByName(*layoutName)
 		if err != nil {
-			return nil, errors.New("invalid size")
+			return nil, err
+		}
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return nil, errors.New("-tls-cert and -tls-key must be used together")
+	}
+	if *tlsSelfSigned && *tlsCert != "" {
+		return nil, errors.New("-tls-self-signed can't be combined with -tls-cert")
+	}
+
+	if *token == "" {
+		*token = os.Getenv("OBERON_EMU_TOKEN")
+	}
+	if *basicAuth == "" {
+		*basicAuth = os.Getenv("OBERON_EMU_BASIC_AUTH")
+	}
+	var user, password string
+	if *basicAuth != "" {
+		var ok bool
+		user, password, ok = strings.Cut(*basicAuth, ":")
+		if !ok || user == "" {
+			return nil, errors.New("invalid basic authentication, expected USER:PASSWORD")
 		}
-		sizeRect = image.Rect(0, 0,
-			clamp(w, 32, maxWidth)&^31,
-			clamp(h, 32, maxHeight),
-		)
 	}
 
 	return &options{
+		machine:        machine,
+		keys:           keys,
+		layout:         layout,
 		http:           *http,
 		open:           *open,
+		shared:         *shared,
 		fullscreen:     *fullscreen,
 		zoom:           *zoom,
-		leds:           *leds,
-		mem:            *mem,
-		size:           *size,
-		sizeRect:       sizeRect,
-		bootFromSerial: *bootFromSerial,
-		serialIn:       *serialIn,
-		serialOut:      *serialOut,
-		diskImageFile:  diskImageFile,
+		showLEDs:       *showLEDs,
+		captureDir:     *captureDir,
+		tlsCert:        *tlsCert,
+		tlsKey:         *tlsKey,
+		tlsSelfSigned:  *tlsSelfSigned,
+		token:          *token,
+		user:           user,
+		password:       password,
+		allowedOrigins: allowedOrigins,
 	}, nil
 }
-
-func clamp(x, min, max int) int {
-	if x < min {
-		return min
-	}
-	if x > max {
-		return max
-	}
-	return x
-}
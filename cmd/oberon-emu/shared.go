@@ -0,0 +1,193 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"image"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fzipp/oberon/capture"
+	"github.com/fzipp/oberon/clipboard"
+	"github.com/fzipp/oberon/emulator"
+	"github.com/fzipp/oberon/keybind"
+	"github.com/fzipp/oberon/ps2"
+	"github.com/fzipp/oberon/risc"
+
+	"github.com/fzipp/oberon/cmd/oberon-emu/internal/canvas"
+)
+
+// A session shares one persistent machine between all connected
+// browsers. Every viewer sees the same screen, but only the viewer
+// holding the seat controls mouse, keyboard and clipboard. The seat goes
+// to the first viewer that is not view-only and passes on to the next
+// one when its holder disconnects. The machine never waits for the
+// viewers: each one is sent its updates by a goroutine of its own, see
+// viewer.
+type session struct {
+	mu        sync.Mutex
+	m         *emulator.Machine
+	clipboard *clipboard.Memory
+	screen    *screenCapture
+	viewers   []*viewer
+	seat      *viewer
+	gestures  gestures
+	keys      *keybind.Keyboard
+	layout    *ps2.Layout // keyboard layout in character mode, or nil
+	showLEDs  bool
+	leds      uint8 // LED state shown by the viewers
+}
+
+// startSession creates the shared machine and starts running it. Its
+// serve method serves each browser connection. The machine
+// shuts down when the emulator is interrupted.
+func startSession(opt *options) (*session, error) {
+	s := &session{
+		keys:     keybind.NewKeyboard(opt.keys),
+		layout:   opt.layout,
+		showLEDs: opt.showLEDs,
+	}
+	s.clipboard = clipboard.NewMemory(s.writeClipboard)
+	c := opt.machine
+	c.Clipboard = clipboard.New(s.clipboard)
+	m, err := emulator.New(c)
+	if err != nil {
+		return nil, err
+	}
+	s.m = m
+	s.screen = newScreenCapture(m.Framebuffer(), opt.captureDir)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		s.mu.Lock()
+		s.screen.stopRecording()
+		closeMachine(m)
+		os.Exit(0)
+	}()
+
+	go emulator.Run(m, s)
+	return s, nil
+}
+
+// Input locks the session for the frame and shows the LEDs changed by
+// the previous frame. The viewers' input is passed to the machine as it
+// arrives, see serve.
+func (s *session) Input(m *emulator.Machine) bool {
+	s.mu.Lock()
+	if leds := m.LEDs(); s.showLEDs && leds != s.leds {
+		s.leds = leds
+		for _, v := range s.viewers {
+			v.setLEDs(leds)
+		}
+	}
+	s.gestures.tick(m, time.Now())
+	return true
+}
+
+// Display passes the display updates of the frame to all viewers and
+// unlocks the session.
+func (s *session) Display(fb *risc.Framebuffer, damage []image.Rectangle) {
+	defer s.mu.Unlock()
+	s.screen.update(damage)
+	for _, v := range s.viewers {
+		v.update(fb, damage)
+	}
+}
+
+// serve attaches a browser connection to the session until it is closed.
+func (s *session) serve(ctx *canvas.Context) {
+	v := s.join(ctx)
+	defer s.leave(v)
+
+	for event := range ctx.Events() {
+		if _, ok := event.(canvas.CloseEvent); ok {
+			return
+		}
+		s.mu.Lock()
+		if s.seat == v {
+			handleEvent(event, s.m, s.clipboard, s.screen, &s.gestures, s.keys, s.layout)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// serveScreenshot responds with a PNG image of the current screen.
+func (s *session) serveScreenshot(w http.ResponseWriter, _ *http.Request) {
+	var buf bytes.Buffer
+	s.mu.Lock()
+	err := capture.WritePNG(&buf, s.m.Framebuffer())
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// join adds a viewer for the browser of ctx and sends it the screen.
+func (s *session) join(ctx *canvas.Context) *viewer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := newViewer(ctx)
+	v.update(s.m.Framebuffer(), nil)
+	if s.showLEDs {
+		v.setLEDs(s.leds)
+	}
+	s.viewers = append(s.viewers, v)
+	if s.seat == nil && !ctx.ViewOnly() {
+		s.takeSeat(v)
+	}
+	return v
+}
+
+// leave removes a viewer and waits until it stopped sending updates.
+func (s *session) leave(v *viewer) {
+	s.mu.Lock()
+	s.viewers = slices.DeleteFunc(s.viewers, func(w *viewer) bool {
+		return w == v
+	})
+	if s.seat == v {
+		s.takeSeat(nil)
+		for _, w := range s.viewers {
+			if !w.ctx.ViewOnly() {
+				s.takeSeat(w)
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+	v.close()
+}
+
+// takeSeat gives the input seat to v, or to nobody if v is nil.
+// The caller must hold s.mu.
+func (s *session) takeSeat(v *viewer) {
+	if s.seat != nil {
+		// Release the buttons the previous holder may have left pressed.
+		s.m.ReleaseMouseButtons()
+		s.gestures = gestures{}
+		s.keys = keybind.NewKeyboard(s.keys.Bindings())
+	}
+	s.seat = v
+}
+
+// writeClipboard writes the text put on the clipboard by Oberon to the
+// clipboard of the seat holder's page. It is called during a frame,
+// while the session is locked.
+func (s *session) writeClipboard(text string) {
+	if s.seat != nil {
+		s.seat.writeClipboard(text)
+	}
+}
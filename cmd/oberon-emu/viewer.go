@@ -0,0 +1,162 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package main
+
+import (
+	"image"
+	"sync"
+
+	"github.com/fzipp/oberon/risc"
+
+	"github.com/fzipp/oberon/cmd/oberon-emu/internal/canvas"
+)
+
+// maxPendingRects is the number of pending damage rectangles of a viewer
+// above which they are joined into their bounding box.
+const maxPendingRects = 64
+
+// A viewer sends the display of a shared session to one browser. The
+// updates are sent by a goroutine of the viewer, so that a slow browser
+// only delays its own updates: the session hands the viewer copies of
+// the changed pixels, which are combined with the pending ones until
+// the viewer gets to send them.
+type viewer struct {
+	ctx *canvas.Context
+
+	mu        sync.Mutex       // guards the pending updates
+	pending   risc.Framebuffer // framebuffer with the pending changes
+	damage    []image.Rectangle
+	leds      int     // pending LED state, or -1
+	clipboard *string // pending clipboard text, or nil
+	wake      chan struct{}
+
+	sent risc.Framebuffer // framebuffer sent to the browser
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newViewer starts sending the updates to the browser of ctx. The first
+// update must show the whole screen.
+func newViewer(ctx *canvas.Context) *viewer {
+	v := &viewer{
+		ctx:  ctx,
+		leds: -1,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go v.run()
+	return v
+}
+
+// update copies the damaged regions of the framebuffer for the browser.
+// The whole screen is copied if the framebuffer changed its size.
+func (v *viewer) update(fb *risc.Framebuffer, damage []image.Rectangle) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.pending.Rect != fb.Rect {
+		v.pending.Rect = fb.Rect
+		v.pending.Pix = make([]uint32, fb.Rect.Dx()/32*fb.Rect.Dy())
+		v.damage = nil
+		damage = []image.Rectangle{image.Rect(0, 0, fb.Rect.Dx()/32-1, fb.Rect.Dy()-1)}
+	}
+	v.pending.Palette = fb.Palette
+	for _, d := range damage {
+		copyWords(&v.pending, fb, d)
+	}
+	v.damage = append(v.damage, damage...)
+	if len(v.damage) > maxPendingRects {
+		b := v.damage[0]
+		for _, d := range v.damage[1:] {
+			b = b.Union(d)
+		}
+		v.damage = []image.Rectangle{b}
+	}
+	v.signal()
+}
+
+// setLEDs shows the LEDs on the page.
+func (v *viewer) setLEDs(value uint8) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.leds = int(value)
+	v.signal()
+}
+
+// writeClipboard writes a text to the clipboard of the page.
+func (v *viewer) writeClipboard(text string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.clipboard = &text
+	v.signal()
+}
+
+func (v *viewer) signal() {
+	select {
+	case v.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close stops sending updates and waits until the viewer's goroutine
+// has stopped using the context.
+func (v *viewer) close() {
+	close(v.stop)
+	<-v.done
+}
+
+func (v *viewer) run() {
+	defer close(v.done)
+	for {
+		select {
+		case <-v.stop:
+			return
+		case <-v.wake:
+			v.send()
+		}
+	}
+}
+
+// send sends the pending updates to the browser.
+func (v *viewer) send() {
+	v.mu.Lock()
+	damage := v.damage
+	v.damage = nil
+	if v.sent.Rect != v.pending.Rect {
+		v.sent.Rect = v.pending.Rect
+		v.sent.Pix = make([]uint32, len(v.pending.Pix))
+	}
+	v.sent.Palette = v.pending.Palette
+	for _, d := range damage {
+		copyWords(&v.sent, &v.pending, d)
+	}
+	leds, clipboard := v.leds, v.clipboard
+	v.leds, v.clipboard = -1, nil
+	v.mu.Unlock()
+
+	size := v.sent.Rect
+	if v.ctx.CanvasWidth() != size.Dx() || v.ctx.CanvasHeight() != size.Dy() {
+		v.ctx.ResizeCanvas(size.Dx(), size.Dy())
+	}
+	for _, d := range damage {
+		v.ctx.UpdateDisplay(&v.sent, d)
+	}
+	if leds >= 0 {
+		v.ctx.SetLEDs(uint8(leds))
+	}
+	if clipboard != nil {
+		v.ctx.ClipboardWriteText(*clipboard)
+	}
+}
+
+// copyWords copies the framebuffer words of a damaged region, given in
+// words and lines, between framebuffers of the same size.
+func copyWords(dst, src *risc.Framebuffer, r image.Rectangle) {
+	width := src.Rect.Dx() / 32
+	for line := r.Min.Y; line <= r.Max.Y; line++ {
+		i := line * width
+		copy(dst.Pix[i+r.Min.X:i+r.Max.X+1], src.Pix[i+r.Min.X:i+r.Max.X+1])
+	}
+}
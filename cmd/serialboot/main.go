@@ -0,0 +1,88 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+// Command serialboot feeds an Oberon boot file to an emulator that was
+// started with -boot-from-serial, like a host computer would feed the
+// boot loader of the FPGA board over RS-232.
+//
+// The boot file is a memory image of the inner core starting at address 0,
+// e.g. the output of ORL.Link. It is encoded in the block format that the
+// boot ROM expects and written to a file, e.g. a named pipe or PTY that
+// the emulator reads via -serial-in, or served to an emulator that
+// connects via -serial-tcp.
+//
+//	Usage:
+//	    serialboot [-o file | -listen address] boot_file
+//
+//	Flags:
+//	    -o       Output file, standard output if not set.
+//	    -listen  TCP address to wait for the emulator to connect to,
+//	             e.g. localhost:2323.
+//
+// Example:
+//
+//	$ mkfifo serial
+//	$ serialboot -o serial Modules.bin &
+//	$ oberon-emu -boot-from-serial -serial-in serial
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/fzipp/oberon/serial"
+)
+
+func usage() {
+	fail("Usage: serialboot [-o file | -listen address] boot_file")
+}
+
+func main() {
+	output := flag.String("o", "", "output `file`, e.g. a named pipe or PTY (default: standard output)")
+	listen := flag.String("listen", "", "wait for the emulator to connect to TCP `address`")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 || (*output != "" && *listen != "") {
+		usage()
+	}
+
+	image, err := os.ReadFile(flag.Arg(0))
+	check(err)
+
+	var w io.Writer = os.Stdout
+	switch {
+	case *output != "":
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+		check(err)
+		defer f.Close()
+		w = f
+	case *listen != "":
+		l, err := net.Listen("tcp", *listen)
+		check(err)
+		_, _ = fmt.Fprintln(os.Stderr, "Waiting for connection on "+l.Addr().String())
+		conn, err := l.Accept()
+		check(err)
+		_ = l.Close()
+		defer conn.Close()
+		w = conn
+	}
+
+	err = serial.WriteBootStream(w, image)
+	check(err)
+}
+
+func check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(message any) {
+	_, _ = fmt.Fprintln(os.Stderr, message)
+	os.Exit(1)
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package emulator
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"github.com/fzipp/oberon/risc"
+)
+
+// RegisterFlags defines the command line flags that configure the
+// machine in the flag set. After parsing, the remaining arguments must
+// be passed to SetArgs.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.LogLEDs, "leds", false, "Log LED state on stdout")
+	fs.StringVar(&c.LEDLog, "led-log", "", "Write the LED changes with their time in seconds to `FILE`")
+	fs.IntVar(&c.Mem, "mem", 0, "Set memory size in `MEGS`")
+	fs.Func("size", "Set framebuffer size to `WIDTHxHEIGHT`", func(s string) error {
+		var w, h int
+		_, err := fmt.Sscanf(s, "%dx%d", &w, &h)
+		if err != nil {
+			return errors.New("invalid size")
+		}
+		c.ScreenSize = image.Pt(
+			clamp(w, 32, MaxScreenWidth)&^31,
+			clamp(h, 32, MaxScreenHeight),
+		)
+		return nil
+	})
+	fs.Func("palette", "Set the display colors to a theme (classic, high-contrast, inverted, solarized) or to `BLACK,WHITE` hex colors, e.g. #000000,#ffff00", func(s string) error {
+		p, err := risc.ParsePalette(s)
+		if err != nil {
+			return err
+		}
+		c.Palette = &p
+		return nil
+	})
+	fs.BoolVar(&c.FPGAExact, "fpga-exact", false, "Decode addresses like the FPGA board (20 bits, 1 MiB RAM)")
+	fs.BoolVar(&c.Strict, "strict", false, "Stop on accesses to unmapped memory, ROM writes and guard regions")
+	fs.Func("guard", "Add a guard region `START-END` (hexadecimal, end exclusive) for -strict mode", func(s string) error {
+		g, err := parseRegion(s)
+		if err != nil {
+			return err
+		}
+		c.Guards = append(c.Guards, g)
+		return nil
+	})
+	fs.BoolVar(&c.BootFromSerial, "boot-from-serial", false, "Boot from serial line (disk image not required)")
+	fs.StringVar(&c.ROM, "rom", "", "Load the boot ROM from `FILE` (raw words, Intel HEX .hex or $readmemh .mem)")
+	fs.StringVar(&c.SerialIn, "serial-in", "", "Read serial input from `FILE`")
+	fs.StringVar(&c.SerialOut, "serial-out", "", "Write serial output to `FILE`")
+	fs.StringVar(&c.SerialTCP, "serial-tcp", "", "Connect the serial line to TCP `ADDRESS`, e.g. of serialboot -listen")
+	fs.StringVar(&c.CPUProfile, "cpuprofile", "", "Write an execution profile in pprof format to `FILE`")
+	fs.StringVar(&c.Symbols, "symbols", "", "Name procedures in the execution profile with the symbol map `FILE`")
+}
+
+// SetArgs takes the disk image file from the command line arguments
+// that remain after parsing the flags, and checks that the flags can
+// be combined.
+func (c *Config) SetArgs(args []string) error {
+	if !c.BootFromSerial {
+		if len(args) < 1 {
+			return errors.New("missing argument")
+		}
+		c.DiskImage = args[0]
+	}
+	if c.FPGAExact && (c.Mem > 0 || c.ScreenSize != (image.Point{}) || c.Resizable) {
+		return errors.New("-fpga-exact can't be combined with -mem, -size or -resize")
+	}
+	return c.validate()
+}
+
+func parseRegion(s string) (risc.Region, error) {
+	start, end, _ := strings.Cut(s, "-")
+	a, err1 := parseHex(start)
+	b, err2 := parseHex(end)
+	if err1 != nil || err2 != nil || b <= a {
+		return risc.Region{}, fmt.Errorf("invalid region %q", s)
+	}
+	return risc.Region{Start: a, End: b}, nil
+}
+
+func parseHex(s string) (uint32, error) {
+	s = strings.TrimPrefix(strings.ToLower(s), "0x")
+	x, err := strconv.ParseUint(s, 16, 32)
+	return uint32(x), err
+}
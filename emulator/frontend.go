@@ -0,0 +1,49 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package emulator
+
+import (
+	"image"
+	"time"
+
+	"github.com/fzipp/oberon/risc"
+)
+
+// A Frontend shows the display of a machine and forwards the user's
+// input to it. Run calls its methods alternately from one goroutine:
+// Input before each frame and Display after it.
+type Frontend interface {
+	// Input passes the input that arrived since the last frame to the
+	// machine. It reports false if the frontend was closed.
+	Input(m *Machine) bool
+
+	// Display shows the damaged regions of the framebuffer after a
+	// frame, as returned by Machine.Frame. The framebuffer changes its
+	// size if the display was resized.
+	Display(fb *risc.Framebuffer, damage []image.Rectangle)
+}
+
+// Run executes the machine in real time with the frontend until the
+// frontend is closed. Errors of the machine are written to its error log.
+func Run(m *Machine, f Frontend) {
+	fb := m.Framebuffer()
+	frame := time.Second / time.Duration(m.frameRate)
+	next := time.Now()
+	for f.Input(m) {
+		damage, err := m.Frame()
+		if err != nil {
+			m.logError(err)
+		}
+		f.Display(fb, damage)
+
+		next = next.Add(frame)
+		if delay := time.Until(next); delay > 0 {
+			time.Sleep(delay)
+		} else {
+			// Don't try to catch up when the frames take too long.
+			next = time.Now()
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package emulator
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fzipp/oberon/risc"
+)
+
+// maxLEDEvents is the number of LED events a subscriber can fall behind
+// before the oldest ones are dropped.
+const maxLEDEvents = 64
+
+// An LEDEvent is a change of the eight LEDs of the machine. Oberon shows
+// the progress of the boot process and the trap numbers on the LEDs.
+type LEDEvent struct {
+	// Time is the time of the change since the machine was created,
+	// without the pauses.
+	Time time.Duration
+
+	// Value is the new state of the LEDs, with bit i for LED i.
+	Value uint8
+}
+
+// String formats the event as a line of the LED log, e.g.
+// "12.345 0x84 7----2--".
+func (e LEDEvent) String() string {
+	return fmt.Sprintf("%.3f 0x%02X %s", e.Time.Seconds(), e.Value, ledString(e.Value))
+}
+
+// ledString shows the LEDs that are on by their number and the others
+// as '-', from LED 7 to LED 0.
+func ledString(value uint8) string {
+	var b strings.Builder
+	for i := 7; i >= 0; i-- {
+		if value&(1<<i) != 0 {
+			b.WriteByte(byte('0' + i))
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// consoleLEDs prints the state of the LEDs on standard output.
+type consoleLEDs struct{}
+
+func (led *consoleLEDs) Write(value uint32) {
+	fmt.Println("LEDs:", ledString(uint8(value)))
+}
+
+// ledMonitor is the LED device of the machine. It records the changes
+// of the LEDs and passes the writes on to the LED device of the
+// configuration, if any. It is used by the machine with m.mu held.
+type ledMonitor struct {
+	m     *Machine
+	next  risc.LED
+	value uint8
+	log   io.WriteCloser // LED log of the configuration, or nil
+	subs  []chan LEDEvent
+}
+
+func (l *ledMonitor) Write(value uint32) {
+	if l.next != nil {
+		l.next.Write(value)
+	}
+	v := uint8(value)
+	if v == l.value {
+		return
+	}
+	l.value = v
+	e := LEDEvent{Time: time.Since(l.m.start), Value: v}
+	if l.log != nil {
+		if _, err := fmt.Fprintln(l.log, e); err != nil {
+			l.m.logError(fmt.Errorf("can't write LED log: %w", err))
+			l.log.Close()
+			l.log = nil
+		}
+	}
+	for _, sub := range l.subs {
+		select {
+		case sub <- e:
+		default:
+			// Drop the oldest event for the latest one.
+			select {
+			case <-sub:
+			default:
+			}
+			sub <- e
+		}
+	}
+}
+
+// close ends the subscriptions and closes the LED log.
+func (l *ledMonitor) close() error {
+	for _, sub := range l.subs {
+		close(sub)
+	}
+	l.subs = nil
+	if l.log == nil {
+		return nil
+	}
+	err := l.log.Close()
+	l.log = nil
+	return err
+}
+
+// LEDs returns the state of the eight LEDs, with bit i for LED i.
+func (m *Machine) LEDs() uint8 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leds.value
+}
+
+// SubscribeLEDs returns a channel that receives the changes of the
+// LEDs, and a function that ends the subscription. The machine never
+// waits for a subscriber: if it falls behind by more than 64 changes,
+// the oldest ones are dropped. The channel is closed when the
+// subscription ends or the machine is closed.
+func (m *Machine) SubscribeLEDs() (<-chan LEDEvent, func()) {
+	sub := make(chan LEDEvent, maxLEDEvents)
+	m.mu.Lock()
+	m.leds.subs = append(m.leds.subs, sub)
+	m.mu.Unlock()
+	cancel := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if i := slices.Index(m.leds.subs, sub); i >= 0 {
+			m.leds.subs = slices.Delete(m.leds.subs, i, i+1)
+			close(sub)
+		}
+	}
+	return sub, cancel
+}
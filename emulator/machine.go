@@ -0,0 +1,480 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+// Package emulator hosts a Project Oberon machine for a frontend that
+// shows its display and forwards the user's input.
+//
+// A Machine is a risc.RISC set up with its devices as described by a
+// Config, which the commands fill from their command line flags. Run
+// executes a machine in real time and exchanges display updates and
+// input with a Frontend. Programs embedding a machine can instead run
+// it in the background with Start, inject input events and subscribe
+// to the changes of its display:
+//
+//	m, err := emulator.New(emulator.Config{DiskImage: "Oberon.dsk"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer m.Close()
+//	updates, cancel := m.Subscribe()
+//	defer cancel()
+//	m.Start(ctx)
+//	for range updates {
+//		img := m.Screenshot()
+//		// ...
+//	}
+//
+// The methods of a Machine may be called from multiple goroutines.
+package emulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fzipp/oberon/profile"
+	"github.com/fzipp/oberon/risc"
+	"github.com/fzipp/oberon/serial"
+	"github.com/fzipp/oberon/spi"
+)
+
+// CPUHz is the clock rate of the emulated processor in cycles per second.
+const CPUHz = 25000000
+
+// Limits of the framebuffer size.
+const (
+	MaxScreenWidth  = 2048
+	MaxScreenHeight = 2048
+)
+
+// A Config describes the machine and its devices.
+type Config struct {
+	DiskImage      string   // Disk image file, not needed when booting from the serial line
+	Disk           risc.SPI // Disk device used instead of DiskImage, if set
+	BootFromSerial bool     // Boot the inner core over the serial line
+	ROM            string   // Boot ROM file (see risc.LoadROM), or empty for the built-in boot loader
+
+	// If Mem is set, or ScreenSize, or if the display is Resizable, the
+	// framebuffer is moved behind Mem megabytes of RAM. This requires a
+	// display driver that reads the display info block, see
+	// risc.RISC.Configure.
+	Mem        int         // RAM size in megabytes
+	ScreenSize image.Point // Framebuffer size in pixels, or zero for the default size
+	Resizable  bool        // The frontend may resize the display at runtime
+
+	FPGAExact bool          // Decode addresses like the FPGA board
+	Strict    bool          // Stop on accesses to unmapped memory, see risc.RISC.SetStrict
+	Guards    []risc.Region // Guard regions for strict mode
+	Palette   *risc.Palette // Display colors, or nil for risc.DefaultPalette
+
+	SerialIn  string      // Read serial input from this file
+	SerialOut string      // Write serial output to this file
+	SerialTCP string      // Connect the serial line to this TCP address
+	Serial    risc.Serial // Serial device used instead of the above, if set
+
+	LogLEDs   bool           // Print the LED state on standard output
+	LEDs      risc.LED       // LED device used instead of LogLEDs, if set
+	LEDLog    string         // Write the changes of the LEDs with their time to this file
+	Clipboard risc.Clipboard // Clipboard device of the frontend, if any
+
+	CPUProfile string // Write an execution profile to this file on Close
+	Symbols    string // Symbol map file for the execution profile
+
+	FrameRate int       // Frames per second, 60 if zero
+	ErrorLog  io.Writer // Destination of the machine's errors, standard error if nil
+}
+
+// ScreenBounds returns the framebuffer bounds of the configured machine
+// before the display is resized.
+func (c *Config) ScreenBounds() image.Rectangle {
+	if c.ScreenSize == (image.Point{}) || c.FPGAExact {
+		return image.Rect(0, 0, risc.FramebufferWidth, risc.FramebufferHeight)
+	}
+	return image.Rectangle{Max: c.ScreenSize}
+}
+
+// validate checks that the settings of the configuration can be
+// combined.
+func (c *Config) validate() error {
+	if c.SerialTCP != "" && (c.SerialIn != "" || c.SerialOut != "") {
+		return errors.New("a serial TCP connection (-serial-tcp) can't be combined with serial files (-serial-in, -serial-out)")
+	}
+	return nil
+}
+
+// A Machine is an emulated Project Oberon machine with its devices.
+type Machine struct {
+	mu        sync.Mutex // guards r and the fields below
+	r         *risc.RISC
+	start     time.Time // machine time zero, shifted by the pauses
+	pausedAt  time.Time // zero if not paused
+	frameRate int
+	errorLog  io.Writer
+	raw       *serial.Raw
+	conn      *serial.Conn
+	prof      *profile.Profile
+	cfg       Config
+	subs      []*subscription
+	leds      *ledMonitor
+
+	cancel context.CancelFunc // stops the machine started by Start
+	done   chan struct{}      // closed when the started machine stopped
+	typing chan struct{}      // closed to stop typing, see Type
+}
+
+// New creates a machine as described by the configuration.
+func New(c Config) (*Machine, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	// The files and connections opened so far are closed if a later
+	// step fails.
+	var opened []io.Closer
+	ok := false
+	defer func() {
+		if !ok {
+			for _, f := range opened {
+				_ = f.Close()
+			}
+		}
+	}()
+	m := &Machine{
+		r:         risc.New(),
+		frameRate: c.FrameRate,
+		errorLog:  c.ErrorLog,
+		cfg:       c,
+	}
+	if m.frameRate <= 0 {
+		m.frameRate = 60
+	}
+	if m.errorLog == nil {
+		m.errorLog = os.Stderr
+	}
+
+	r := m.r
+	r.SetSerial(&serial.PCLink{})
+	if c.Clipboard != nil {
+		r.SetClipboard(c.Clipboard)
+	}
+
+	m.leds = &ledMonitor{m: m, next: c.LEDs}
+	if c.LEDs == nil && c.LogLEDs {
+		m.leds.next = &consoleLEDs{}
+	}
+	r.SetLEDs(m.leds)
+
+	if c.BootFromSerial {
+		r.SetSwitches(1)
+	}
+
+	if c.ROM != "" {
+		rom, err := risc.LoadROM(c.ROM)
+		if err == nil {
+			err = r.SetROM(rom)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't use boot ROM: %w", err)
+		}
+	}
+
+	if c.FPGAExact {
+		err := r.Configure(risc.FPGAConfig())
+		if err != nil {
+			return nil, fmt.Errorf("can't configure memory: %w", err)
+		}
+	} else if c.Mem > 0 || c.ScreenSize != (image.Point{}) || c.Resizable {
+		size := c.ScreenBounds()
+		r.ConfigureMemory(c.Mem, size.Dx(), size.Dy())
+	}
+
+	if c.Palette != nil {
+		r.SetPalette(*c.Palette)
+	}
+
+	r.SetStrict(c.Strict)
+	r.SetGuardRegions(c.Guards)
+
+	if c.Disk != nil {
+		r.SetSPI(1, c.Disk)
+	} else {
+		disk, err := spi.NewDisk(c.DiskImage)
+		if err != nil {
+			return nil, fmt.Errorf("can't use disk image: %w", err)
+		}
+		r.SetSPI(1, disk)
+	}
+
+	if c.SerialIn != "" || c.SerialOut != "" {
+		raw, err := serial.Open(c.SerialIn, c.SerialOut)
+		if err != nil {
+			return nil, fmt.Errorf("can't open serial I/O: %w", err)
+		}
+		opened = append(opened, raw)
+		r.SetSerial(raw)
+		m.raw = raw
+	}
+
+	if c.SerialTCP != "" {
+		conn, err := serial.Dial("tcp", c.SerialTCP)
+		if err != nil {
+			return nil, fmt.Errorf("can't connect serial line: %w", err)
+		}
+		opened = append(opened, conn)
+		r.SetSerial(conn)
+		m.conn = conn
+	}
+
+	if c.Serial != nil {
+		r.SetSerial(c.Serial)
+	}
+
+	if c.LEDLog != "" {
+		f, err := os.Create(c.LEDLog)
+		if err != nil {
+			return nil, fmt.Errorf("can't create LED log: %w", err)
+		}
+		opened = append(opened, f)
+		m.leds.log = f
+	}
+
+	if c.CPUProfile != "" {
+		m.prof = profile.New()
+		r.SetProfiler(m.prof)
+	}
+
+	m.start = time.Now()
+	ok = true
+	return m, nil
+}
+
+// RISC returns the emulated processor with its memory and framebuffer.
+// Unlike the methods of the machine, it must not be used while the
+// machine is running in another goroutine.
+func (m *Machine) RISC() *risc.RISC {
+	return m.r
+}
+
+// Framebuffer returns the framebuffer of the machine. Its content may
+// only be read by the goroutine that runs the machine, e.g. in the
+// Display method of a frontend. Other goroutines use Screenshot.
+func (m *Machine) Framebuffer() *risc.Framebuffer {
+	return m.r.Framebuffer()
+}
+
+// Screenshot returns a copy of the current screen content.
+func (m *Machine) Screenshot() *image.Paletted {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fb := m.r.Framebuffer()
+	return fb.Snapshot(fb.Rect)
+}
+
+// FrameRate returns the number of frames per second.
+func (m *Machine) FrameRate() int {
+	return m.frameRate
+}
+
+// Frame executes the machine for the duration of one frame and returns
+// the damaged regions of the framebuffer, see
+// risc.RISC.GetFramebufferDamageRectsAndReset. The subscribers are
+// notified of the changes. An error doesn't stop the machine; the next
+// frame continues the execution. A paused machine is not executed.
+func (m *Machine) Frame() ([]image.Rectangle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.pausedAt.IsZero() {
+		return nil, nil
+	}
+	m.r.SetTime(uint32(time.Since(m.start).Milliseconds()))
+	err := m.r.Run(CPUHz / m.frameRate)
+	damage := m.r.GetFramebufferDamageRectsAndReset()
+	m.publish(damage)
+	return damage, err
+}
+
+// Start runs the machine in real time in a new goroutine until the
+// context is done or Stop is called. Errors of the machine are written
+// to its error log. A machine runs either with Start or with Run, not
+// both.
+func (m *Machine) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done != nil {
+		return errors.New("machine is already running")
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	go m.loop(ctx, m.done)
+	return nil
+}
+
+func (m *Machine) loop(ctx context.Context, done chan struct{}) {
+	defer func() {
+		m.mu.Lock()
+		m.cancel()
+		m.cancel, m.done = nil, nil
+		m.mu.Unlock()
+		close(done)
+	}()
+	// The ticker drops the frames that take too long instead of
+	// catching up.
+	ticker := time.NewTicker(time.Second / time.Duration(m.frameRate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := m.Frame(); err != nil {
+			m.logError(err)
+		}
+	}
+}
+
+// Stop stops the machine started by Start and waits until it has
+// stopped. The machine can be started again.
+func (m *Machine) Stop() {
+	m.mu.Lock()
+	cancel, done := m.cancel, m.done
+	m.mu.Unlock()
+	if done == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Pause suspends the execution of the machine. The clock of the
+// machine stands still until Resume is called.
+func (m *Machine) Pause() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pausedAt.IsZero() {
+		m.pausedAt = time.Now()
+	}
+}
+
+// Resume continues the execution of a paused machine.
+func (m *Machine) Resume() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.pausedAt.IsZero() {
+		m.start = m.start.Add(time.Since(m.pausedAt))
+		m.pausedAt = time.Time{}
+	}
+}
+
+// Paused reports whether the machine is paused.
+func (m *Machine) Paused() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.pausedAt.IsZero()
+}
+
+// Reset restarts the machine from the boot ROM.
+func (m *Machine) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.r.Reset()
+}
+
+// The input methods don't wait for a running frame; the machine
+// takes the input over at the start of the next frame.
+
+// MouseMoved sets the position of the mouse, with the origin at the
+// bottom left of the display.
+func (m *Machine) MouseMoved(x, y int) {
+	m.r.MouseMoved(x, y)
+}
+
+// MouseButton presses or releases mouse button 1 (left), 2 (middle)
+// or 3 (right).
+func (m *Machine) MouseButton(button int, down bool) {
+	m.r.MouseButton(button, down)
+}
+
+// MouseWheel turns the mouse wheel by the given number of steps,
+// positive for scrolling down, see risc.RISC.MouseWheel.
+func (m *Machine) MouseWheel(steps int) {
+	m.r.MouseWheel(steps)
+}
+
+// ReleaseMouseButtons releases all mouse buttons.
+func (m *Machine) ReleaseMouseButtons() {
+	for button := 1; button <= 3; button++ {
+		m.r.MouseButton(button, false)
+	}
+}
+
+// KeyboardInput sends PS/2 keyboard scancodes. It returns
+// risc.ErrKeyboardOverflow if the machine doesn't read the keyboard
+// quickly enough.
+func (m *Machine) KeyboardInput(ps2commands []byte) error {
+	return m.r.KeyboardInput(ps2commands)
+}
+
+// ResizeDisplay changes the size of the framebuffer, see
+// risc.RISC.ResizeDisplay. The size is limited to MaxScreenWidth and
+// MaxScreenHeight and the width rounded down to a multiple of 32.
+func (m *Machine) ResizeDisplay(width, height int) error {
+	if !m.cfg.Resizable {
+		return errors.New("display is not resizable")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.r.ResizeDisplay(
+		clamp(width, 32, MaxScreenWidth)&^31,
+		clamp(height, 32, MaxScreenHeight),
+	)
+}
+
+// Close stops the machine and the typing of a text, closes the serial
+// connection and the LED log and writes the execution profile, if any.
+func (m *Machine) Close() error {
+	m.Stop()
+	m.StopTyping()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sub := range m.subs {
+		close(sub.c)
+	}
+	m.subs = nil
+	errs := []error{m.leds.close()}
+	if m.raw != nil {
+		errs = append(errs, m.raw.Close())
+	}
+	if m.conn != nil {
+		errs = append(errs, m.conn.Close())
+	}
+	if m.prof != nil {
+		errs = append(errs, writeProfile(m.cfg.CPUProfile, m.cfg.Symbols, m.prof, m.r.Mem))
+	}
+	return errors.Join(errs...)
+}
+
+// logError writes an error of the machine to the error log.
+func (m *Machine) logError(err error) {
+	var riscErr *risc.Error
+	if errors.As(err, &riscErr) {
+		_, _ = fmt.Fprintf(m.errorLog, "%s (PC=0x%08X)\n", riscErr, riscErr.PC)
+	} else {
+		_, _ = fmt.Fprintln(m.errorLog, err)
+	}
+}
+
+func clamp(x, min, max int) int {
+	if x < min {
+		return min
+	}
+	if x > max {
+		return max
+	}
+	return x
+}
@@ -0,0 +1,40 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package emulator
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fzipp/oberon/profile"
+)
+
+// writeProfile writes the execution profile of the machine with the
+// memory mem to a file. The profile is annotated with the symbols from
+// the symbol map file, if one is given.
+func writeProfile(filename, symbolsFile string, p *profile.Profile, mem []uint32) error {
+	var syms *profile.Symbols
+	if symbolsFile != "" {
+		f, err := os.Open(symbolsFile)
+		if err != nil {
+			return fmt.Errorf("can't open symbol map: %w", err)
+		}
+		defer f.Close()
+		syms, err = profile.ReadSymbols(f)
+		if err != nil {
+			return fmt.Errorf("can't read symbol map: %w", err)
+		}
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("can't create profile: %w", err)
+	}
+	err = p.Write(f, mem, syms)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("can't write profile: %w", err)
+	}
+	return f.Close()
+}
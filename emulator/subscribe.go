@@ -0,0 +1,86 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package emulator
+
+import (
+	"image"
+	"slices"
+)
+
+// maxDamageRects is the number of pending damage rectangles of a
+// subscriber above which they are joined into their bounding box.
+const maxDamageRects = 64
+
+// An Update notifies a subscriber of changes of the display.
+type Update struct {
+	// Size is the size of the framebuffer in pixels.
+	Size image.Point
+
+	// Damage lists the changed regions of the framebuffer in words
+	// and lines, see risc.RISC.GetFramebufferDamageRectsAndReset.
+	Damage []image.Rectangle
+}
+
+type subscription struct {
+	c chan Update
+}
+
+// Subscribe returns a channel that receives the changes of the display
+// after each frame, and a function that ends the subscription. The
+// machine never waits for a subscriber: the changes of frames that
+// were not received yet are combined into one update. The channel is
+// closed when the subscription ends or the machine is closed.
+func (m *Machine) Subscribe() (<-chan Update, func()) {
+	sub := &subscription{c: make(chan Update, 1)}
+	m.mu.Lock()
+	m.subs = append(m.subs, sub)
+	m.mu.Unlock()
+	cancel := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if i := slices.Index(m.subs, sub); i >= 0 {
+			m.subs = slices.Delete(m.subs, i, i+1)
+			close(sub.c)
+		}
+	}
+	return sub.c, cancel
+}
+
+// publish sends the damage of a frame to the subscribers. The caller
+// must hold m.mu.
+func (m *Machine) publish(damage []image.Rectangle) {
+	if len(damage) == 0 {
+		return
+	}
+	size := m.r.Framebuffer().Rect.Size()
+	for _, sub := range m.subs {
+		u := Update{Size: size, Damage: slices.Clone(damage)}
+		select {
+		case old := <-sub.c:
+			// The previous update was not received yet. After a resize
+			// its damage no longer applies; the resize damages the
+			// whole screen anyway.
+			if old.Size == size {
+				u.Damage = append(old.Damage, u.Damage...)
+			}
+		default:
+		}
+		if len(u.Damage) > maxDamageRects {
+			u.Damage = []image.Rectangle{boundingBox(u.Damage)}
+		}
+		sub.c <- u
+	}
+}
+
+func boundingBox(rects []image.Rectangle) image.Rectangle {
+	b := rects[0]
+	for _, r := range rects[1:] {
+		b = image.Rect(
+			min(b.Min.X, r.Min.X), min(b.Min.Y, r.Min.Y),
+			max(b.Max.X, r.Max.X), max(b.Max.Y, r.Max.Y),
+		)
+	}
+	return b
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package emulator
+
+import (
+	"time"
+
+	"github.com/fzipp/oberon/ps2"
+)
+
+// TypingRate is the number of characters per second typed by Type.
+const TypingRate = 100
+
+// Type types a text on the keyboard of the machine in the background,
+// at TypingRate characters per second, with the keyboard layout of the
+// Oberon keyboard driver, or the US layout if layout is nil. This
+// pastes text into Oberon systems without a clipboard driver. The text
+// replaces a text that is still being typed.
+func (m *Machine) Type(text string, layout *ps2.Layout) {
+	if layout == nil {
+		layout = ps2.US
+	}
+	keys := layout.EncodeText(text)
+	stop := make(chan struct{})
+	m.mu.Lock()
+	if m.typing != nil {
+		close(m.typing)
+	}
+	m.typing = stop
+	m.mu.Unlock()
+	go m.typeKeys(keys, stop)
+}
+
+func (m *Machine) typeKeys(keys [][]byte, stop chan struct{}) {
+	defer func() {
+		m.mu.Lock()
+		if m.typing == stop {
+			m.typing = nil
+		}
+		m.mu.Unlock()
+	}()
+	ticker := time.NewTicker(time.Second / TypingRate)
+	defer ticker.Stop()
+	for len(keys) > 0 {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if err := m.r.KeyboardInput(keys[0]); err != nil {
+			// The keyboard buffer is full, try again later.
+			continue
+		}
+		keys = keys[1:]
+	}
+}
+
+// Typing reports whether the machine is typing a text, see Type.
+func (m *Machine) Typing() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.typing != nil
+}
+
+// StopTyping stops typing the rest of a text, see Type.
+func (m *Machine) StopTyping() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.typing != nil {
+		close(m.typing)
+		m.typing = nil
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+// Package keybind configures the keys that the emulator frontends
+// handle themselves instead of passing them to Oberon, e.g. to reset
+// the machine or to simulate the mouse buttons.
+//
+// A key binding file assigns keys to actions, one action per line,
+// followed by its keys. Modifiers are written in front of a key and
+// joined with '+':
+//
+//	# Comments start with '#'.
+//	reset       F12 Ctrl+Shift+Delete
+//	screenshot  F9 PrintScreen
+//	mouse2      RightAlt
+//	quit        none
+//
+// A line replaces the default keys of its action, and "none" removes
+// them. Actions that are not mentioned keep their default keys.
+//
+// Keys are named like the key values of the browser's keyboard events
+// (https://developer.mozilla.org/en-US/docs/Web/API/UI_Events/Keyboard_event_key_values),
+// e.g. "F1", "Enter", "Delete", "PrintScreen", "Space" or "A", not
+// case-sensitive. The modifier keys are "Control", "Alt", "Shift" and
+// "Meta" (Windows or ⌘ Command key), with the variants "LeftControl",
+// "RightControl" and so on for frontends that can distinguish them. The
+// modifiers are "Ctrl", "Alt", "Shift" and "Meta".
+package keybind
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// An Action is done by a frontend when a bound key is pressed.
+type Action int
+
+const (
+	None       Action = iota // The key is passed to Oberon
+	Reset                    // Reset the machine
+	Quit                     // Quit the emulator
+	Fullscreen               // Toggle the fullscreen mode
+	Screenshot               // Save a screenshot
+	Record                   // Start or stop a screen recording
+	Paste                    // Type the text of the clipboard, or stop typing it
+	Mouse1                   // Hold the left mouse button while the key is pressed
+	Mouse2                   // Hold the middle mouse button while the key is pressed
+	Mouse3                   // Hold the right mouse button while the key is pressed
+
+	numActions
+)
+
+var actionNames = [numActions]string{
+	None:       "none",
+	Reset:      "reset",
+	Quit:       "quit",
+	Fullscreen: "fullscreen",
+	Screenshot: "screenshot",
+	Record:     "record",
+	Paste:      "paste",
+	Mouse1:     "mouse1",
+	Mouse2:     "mouse2",
+	Mouse3:     "mouse3",
+}
+
+func (a Action) String() string {
+	if a < 0 || a >= numActions {
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+	return actionNames[a]
+}
+
+// MouseButton returns the mouse button 1, 2 or 3 that the action
+// simulates, or 0 if it doesn't simulate a mouse button.
+func (a Action) MouseButton() int {
+	if a >= Mouse1 && a <= Mouse3 {
+		return int(a-Mouse1) + 1
+	}
+	return 0
+}
+
+// Modifiers is a set of modifier keys.
+type Modifiers uint8
+
+const (
+	Ctrl Modifiers = 1 << iota
+	Alt
+	Shift
+	Meta
+)
+
+type modifierName struct {
+	mod  Modifiers
+	name string
+}
+
+var modifierNames = []modifierName{
+	{Ctrl, "Ctrl"},
+	{Alt, "Alt"},
+	{Shift, "Shift"},
+	{Meta, "Meta"},
+}
+
+// A Chord is a key pressed together with modifiers.
+type Chord struct {
+	Mods Modifiers
+	Key  string // canonical key name, see KeyName
+}
+
+// String returns the chord in the notation of a key binding file,
+// e.g. "Ctrl+Shift+Delete".
+func (c Chord) String() string {
+	var b strings.Builder
+	for _, m := range modifierNames {
+		if c.Mods&m.mod != 0 {
+			b.WriteString(m.name + "+")
+		}
+	}
+	b.WriteString(c.Key)
+	return b.String()
+}
+
+// ParseChord parses a chord in the notation of a key binding file.
+func ParseChord(s string) (Chord, error) {
+	parts := strings.Split(s, "+")
+	key := parts[len(parts)-1]
+	if key == "" {
+		return Chord{}, fmt.Errorf("missing key in %q", s)
+	}
+	var c Chord
+	for _, p := range parts[:len(parts)-1] {
+		i := slices.IndexFunc(modifierNames, func(m modifierName) bool {
+			return KeyName(p) == KeyName(m.name)
+		})
+		if i < 0 {
+			return Chord{}, fmt.Errorf("unknown modifier %q in %q", p, s)
+		}
+		c.Mods |= modifierNames[i].mod
+	}
+	c.Key = KeyName(key)
+	return c, nil
+}
+
+// standardKeys are the canonical names of keys with names longer than
+// one character, except the function keys.
+var standardKeys = []string{
+	"Control", "Alt", "Shift", "Meta", "AltGraph", "CapsLock", "NumLock", "ScrollLock",
+	"Enter", "Tab", "Space", "Backspace", "Delete", "Insert", "Escape",
+	"ArrowUp", "ArrowDown", "ArrowLeft", "ArrowRight",
+	"Home", "End", "PageUp", "PageDown",
+	"PrintScreen", "Pause", "ContextMenu",
+}
+
+// keyAliases maps the lower case key names to the canonical names.
+var keyAliases = map[string]string{
+	"ctrl":    "Control",
+	"option":  "Alt",
+	"cmd":     "Meta",
+	"command": "Meta",
+	"super":   "Meta",
+	"win":     "Meta",
+	"gui":     "Meta",
+	"return":  "Enter",
+	"esc":     "Escape",
+	"del":     "Delete",
+	"ins":     "Insert",
+	"print":   "PrintScreen",
+	"prtsc":   "PrintScreen",
+	" ":       "Space",
+	"up":      "ArrowUp",
+	"down":    "ArrowDown",
+	"left":    "ArrowLeft",
+	"right":   "ArrowRight",
+}
+
+func init() {
+	for _, k := range standardKeys {
+		keyAliases[strings.ToLower(k)] = k
+	}
+}
+
+// KeyName returns the canonical name of a key: single characters in
+// upper case, and the standard key names and their aliases (e.g.
+// "Return", "Esc", "Cmd") in the spelling of the browser's key values.
+// Other names get an upper case first letter. The frontends use it to
+// name the pressed keys.
+func KeyName(name string) string {
+	lower := strings.ToLower(name)
+	if canonical, ok := keyAliases[lower]; ok {
+		return canonical
+	}
+	for _, side := range []string{"left", "right"} {
+		if rest, ok := strings.CutPrefix(lower, side); ok {
+			if mod, ok := keyAliases[rest]; ok && isModifierKey(mod) {
+				return strings.ToUpper(side[:1]) + side[1:] + mod
+			}
+		}
+	}
+	if len([]rune(name)) == 1 {
+		return strings.ToUpper(name)
+	}
+	if name == "" {
+		return ""
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// Modifier returns the modifier that a modifier key turns on, e.g. Alt
+// for "LeftAlt", or 0 if the key isn't a modifier key.
+func Modifier(key string) Modifiers {
+	switch withoutSide(KeyName(key)) {
+	case "Control":
+		return Ctrl
+	case "Alt":
+		return Alt
+	case "Shift":
+		return Shift
+	case "Meta":
+		return Meta
+	}
+	return 0
+}
+
+func isModifierKey(name string) bool {
+	return name == "Control" || name == "Alt" || name == "Shift" || name == "Meta"
+}
+
+// matchesKey reports whether a bound key matches a pressed key. A
+// modifier key without a side matches both sides, and a pressed
+// modifier key of unknown side matches a bound key of either side.
+func matchesKey(bound, pressed string) bool {
+	if bound == pressed {
+		return true
+	}
+	return withoutSide(bound) == pressed || withoutSide(pressed) == bound
+}
+
+func withoutSide(key string) string {
+	for _, side := range []string{"Left", "Right"} {
+		if rest, ok := strings.CutPrefix(key, side); ok && isModifierKey(rest) {
+			return rest
+		}
+	}
+	return key
+}
+
+// Bindings assigns keys to actions.
+type Bindings struct {
+	chords [numActions][]Chord
+}
+
+// Default returns the default key bindings. The function keys other
+// than F11 are passed to Oberon, so screenshots and recordings have no
+// keys unless they are configured.
+func Default() *Bindings {
+	b := &Bindings{}
+	b.set(Reset, "Ctrl+Shift+Delete")
+	b.set(Quit, "Alt+F4")
+	b.set(Fullscreen, "F11", "Alt+Enter", "Ctrl+Meta+F")
+	b.set(Paste, "Shift+Insert")
+	b.set(Mouse1, "LeftControl")
+	b.set(Mouse2, "LeftAlt")
+	b.set(Mouse3, "LeftMeta")
+	return b
+}
+
+func (b *Bindings) set(a Action, chords ...string) {
+	for _, s := range chords {
+		c, err := ParseChord(s)
+		if err != nil {
+			panic(err)
+		}
+		b.chords[a] = append(b.chords[a], c)
+	}
+}
+
+// Keys returns the keys bound to an action.
+func (b *Bindings) Keys(a Action) []Chord {
+	return b.chords[a]
+}
+
+// Lookup returns the action bound to a key pressed with the active
+// modifiers, or None. Additional active modifiers don't prevent a
+// match, but the chord with the most matching modifiers wins, e.g.
+// Shift+F9 over F9 while Shift is pressed.
+func (b *Bindings) Lookup(key string, mods Modifiers) Action {
+	found, foundMods := None, -1
+	for a := None + 1; a < numActions; a++ {
+		for _, c := range b.chords[a] {
+			n := bits.OnesCount8(uint8(c.Mods))
+			if matchesKey(c.Key, key) && mods&c.Mods == c.Mods && n > foundMods {
+				found, foundMods = a, n
+			}
+		}
+	}
+	return found
+}
+
+// DefaultFile returns the path of the key binding file that the
+// frontends read if it exists, e.g. ~/.config/oberon/keys on Linux.
+func DefaultFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "oberon", "keys")
+}
+
+// Load reads the key bindings from a file, on top of the defaults. If
+// the file is the DefaultFile and doesn't exist, it returns the default
+// bindings.
+func Load(file string) (*Bindings, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && file == DefaultFile() {
+			return Default(), nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	b, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", file, err)
+	}
+	return b, nil
+}
+
+// Parse reads key bindings in the format of a key binding file, on top
+// of the defaults.
+func Parse(r io.Reader) (*Bindings, error) {
+	b := Default()
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		a := Action(slices.Index(actionNames[:], strings.ToLower(fields[0])))
+		if a <= None {
+			return nil, fmt.Errorf("%d: unknown action %q", line, fields[0])
+		}
+		keys := fields[1:]
+		if len(keys) == 1 && strings.EqualFold(keys[0], "none") {
+			keys = nil
+		}
+		var chords []Chord
+		for _, k := range keys {
+			c, err := ParseChord(k)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", line, err)
+			}
+			chords = append(chords, c)
+			// A key triggers only one action.
+			for other := range b.chords {
+				b.chords[other] = slices.DeleteFunc(b.chords[other], func(o Chord) bool {
+					return o == c
+				})
+			}
+		}
+		b.chords[a] = chords
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// A Keyboard tracks the keys that triggered actions, so that releasing
+// a key ends the action it started, even if the modifiers changed in
+// between.
+type Keyboard struct {
+	b       *Bindings
+	pressed map[string]Action
+}
+
+// NewKeyboard returns a keyboard with the key bindings.
+func NewKeyboard(b *Bindings) *Keyboard {
+	return &Keyboard{b: b, pressed: make(map[string]Action)}
+}
+
+// Bindings returns the key bindings of the keyboard.
+func (k *Keyboard) Bindings() *Bindings {
+	return k.b
+}
+
+// Press returns the action bound to a pressed key, or None if the key
+// should be passed to Oberon. The key is named by KeyName.
+func (k *Keyboard) Press(key string, mods Modifiers) Action {
+	a := k.b.Lookup(key, mods)
+	if a == None {
+		delete(k.pressed, key)
+	} else {
+		k.pressed[key] = a
+	}
+	return a
+}
+
+// Release returns the action that a key triggered when it was pressed,
+// or None if its release should be passed to Oberon.
+func (k *Keyboard) Release(key string) Action {
+	a := k.pressed[key]
+	delete(k.pressed, key)
+	return a
+}
@@ -0,0 +1,242 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package keybind_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fzipp/oberon/keybind"
+)
+
+func TestKeyName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"a", "A"},
+		{"A", "A"},
+		{"f1", "F1"},
+		{"F12", "F12"},
+		{"enter", "Enter"},
+		{"Return", "Enter"},
+		{"esc", "Escape"},
+		{"Del", "Delete"},
+		{"ins", "Insert"},
+		{"PrtSc", "PrintScreen"},
+		{" ", "Space"},
+		{"up", "ArrowUp"},
+		{"pagedown", "PageDown"},
+		{"ctrl", "Control"},
+		{"Option", "Alt"},
+		{"cmd", "Meta"},
+		{"Super", "Meta"},
+		{"leftalt", "LeftAlt"},
+		{"RightCtrl", "RightControl"},
+		{"LeftCmd", "LeftMeta"},
+		{"ü", "Ü"},
+		{"unknownKey", "UnknownKey"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := keybind.KeyName(tt.name); got != tt.want {
+			t.Errorf("KeyName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseChord(t *testing.T) {
+	tests := []struct {
+		s    string
+		want keybind.Chord
+	}{
+		{"F12", keybind.Chord{Key: "F12"}},
+		{"Ctrl+Shift+Delete", keybind.Chord{Mods: keybind.Ctrl | keybind.Shift, Key: "Delete"}},
+		{"shift+ctrl+del", keybind.Chord{Mods: keybind.Ctrl | keybind.Shift, Key: "Delete"}},
+		{"Control+Alt+f", keybind.Chord{Mods: keybind.Ctrl | keybind.Alt, Key: "F"}},
+		{"Meta+Esc", keybind.Chord{Mods: keybind.Meta, Key: "Escape"}},
+		{"LeftAlt", keybind.Chord{Key: "LeftAlt"}},
+	}
+	for _, tt := range tests {
+		got, err := keybind.ParseChord(tt.s)
+		if err != nil {
+			t.Errorf("ParseChord(%q): unexpected error: %v", tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseChord(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseChordErrors(t *testing.T) {
+	for _, s := range []string{"", "Ctrl+", "Hyper+A", "A+B"} {
+		if c, err := keybind.ParseChord(s); err == nil {
+			t.Errorf("ParseChord(%q) = %+v, want error", s, c)
+		}
+	}
+}
+
+func TestChordString(t *testing.T) {
+	for _, s := range []string{"F12", "Ctrl+Shift+Delete", "Alt+F4", "Ctrl+Alt+Shift+Meta+A"} {
+		c, err := keybind.ParseChord(s)
+		if err != nil {
+			t.Fatalf("ParseChord(%q): %v", s, err)
+		}
+		if got := c.String(); got != s {
+			t.Errorf("ParseChord(%q).String() = %q", s, got)
+		}
+	}
+}
+
+func TestModifier(t *testing.T) {
+	tests := []struct {
+		key  string
+		want keybind.Modifiers
+	}{
+		{"Control", keybind.Ctrl},
+		{"LeftControl", keybind.Ctrl},
+		{"RightAlt", keybind.Alt},
+		{"Shift", keybind.Shift},
+		{"LeftMeta", keybind.Meta},
+		{"cmd", keybind.Meta},
+		{"A", 0},
+		{"Enter", 0},
+		{"AltGraph", 0},
+	}
+	for _, tt := range tests {
+		if got := keybind.Modifier(tt.key); got != tt.want {
+			t.Errorf("Modifier(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+}
+
+func chords(t *testing.T, ss ...string) []keybind.Chord {
+	t.Helper()
+	var cs []keybind.Chord
+	for _, s := range ss {
+		c, err := keybind.ParseChord(s)
+		if err != nil {
+			t.Fatalf("ParseChord(%q): %v", s, err)
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+func TestParse(t *testing.T) {
+	b, err := keybind.Parse(strings.NewReader(`
+# Comments and empty lines are ignored.
+
+reset       F5 Ctrl+Shift+R  # trailing comment
+QUIT        none
+record      F9 Alt+Enter
+mouse2      RightAlt
+`))
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	tests := []struct {
+		a    keybind.Action
+		want []keybind.Chord
+	}{
+		{keybind.Reset, chords(t, "F5", "Ctrl+Shift+R")},
+		{keybind.Quit, nil},
+		{keybind.Record, chords(t, "F9", "Alt+Enter")},
+		// Alt+Enter was taken by record.
+		{keybind.Fullscreen, chords(t, "F11", "Ctrl+Meta+F")},
+		{keybind.Mouse2, chords(t, "RightAlt")},
+		// Not mentioned, so the default.
+		{keybind.Screenshot, nil},
+		{keybind.Mouse1, chords(t, "LeftControl")},
+	}
+	for _, tt := range tests {
+		if got := b.Keys(tt.a); !slices.Equal(got, tt.want) {
+			t.Errorf("keys of %v: got %v, want %v", tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"reset F12\njump F1\n", `2: unknown action "jump"`},
+		{"none F1\n", `1: unknown action "none"`},
+		{"\n\nquit Hyper+Q\n", `3: unknown modifier "Hyper" in "Hyper+Q"`},
+		{"quit Ctrl+\n", `1: missing key in "Ctrl+"`},
+	}
+	for _, tt := range tests {
+		_, err := keybind.Parse(strings.NewReader(tt.input))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("Parse(%q): got error %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	b, err := keybind.Parse(strings.NewReader(`
+screenshot  F9
+record      Shift+F9
+reset       Ctrl+F9
+quit        Ctrl+Shift+F9
+`))
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	tests := []struct {
+		key  string
+		mods keybind.Modifiers
+		want keybind.Action
+	}{
+		{"F9", 0, keybind.Screenshot},
+		{"F9", keybind.Shift, keybind.Record},
+		{"F9", keybind.Ctrl, keybind.Reset},
+		{"F9", keybind.Ctrl | keybind.Shift, keybind.Quit},
+		// Additional modifiers don't prevent a match.
+		{"F9", keybind.Alt, keybind.Screenshot},
+		{"F9", keybind.Shift | keybind.Meta, keybind.Record},
+		{"F1", 0, keybind.None},
+		// The defaults leave the other function keys to Oberon.
+		{"Enter", keybind.Alt, keybind.Fullscreen},
+		{"F", keybind.Ctrl | keybind.Meta, keybind.Fullscreen},
+		{"F10", 0, keybind.None},
+		{"F12", 0, keybind.None},
+		{"PrintScreen", 0, keybind.None},
+		// A modifier key without a side matches both sides.
+		{"LeftControl", keybind.Ctrl, keybind.Mouse1},
+		{"RightControl", keybind.Ctrl, keybind.None},
+		{"Control", keybind.Ctrl, keybind.Mouse1},
+		{"Insert", keybind.Shift, keybind.Paste},
+		{"Insert", 0, keybind.None},
+	}
+	for _, tt := range tests {
+		if got := b.Lookup(tt.key, tt.mods); got != tt.want {
+			t.Errorf("Lookup(%q, %d) = %v, want %v", tt.key, tt.mods, got, tt.want)
+		}
+	}
+}
+
+func TestKeyboard(t *testing.T) {
+	k := keybind.NewKeyboard(keybind.Default())
+	if a := k.Press("Insert", keybind.Shift); a != keybind.Paste {
+		t.Errorf("Press(Insert, Shift) = %v, want %v", a, keybind.Paste)
+	}
+	// The release ends the action even without the modifier.
+	if a := k.Release("Insert"); a != keybind.Paste {
+		t.Errorf("Release(Insert) = %v, want %v", a, keybind.Paste)
+	}
+	if a := k.Release("Insert"); a != keybind.None {
+		t.Errorf("second Release(Insert) = %v, want %v", a, keybind.None)
+	}
+	if a := k.Press("Insert", 0); a != keybind.None {
+		t.Errorf("Press(Insert) = %v, want %v", a, keybind.None)
+	}
+	if a := k.Release("Insert"); a != keybind.None {
+		t.Errorf("Release(Insert) = %v, want %v", a, keybind.None)
+	}
+}
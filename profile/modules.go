@@ -0,0 +1,203 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package profile
+
+import (
+	"slices"
+	"strings"
+)
+
+// A Module describes an Oberon module loaded into the memory of the
+// emulated machine. All addresses are byte addresses.
+type Module struct {
+	Name       string
+	Addr       uint32 // Address of the module descriptor
+	Size       uint32 // Size of the module block, including the descriptor
+	Code       uint32 // Start of the code section
+	CodeEnd    uint32 // End of the code section (start of the import list)
+	Procedures []Procedure
+}
+
+// A Procedure is a code range within a module.
+type Procedure struct {
+	Name string
+	Addr uint32
+}
+
+// Layout of a module descriptor (Modules.ModDesc in Modules.Mod):
+//
+//	name: ARRAY 32 OF CHAR; next: Module;
+//	key, num, size, refcnt: INTEGER;
+//	data, code, imp, cmd, ent, ptr, unused: INTEGER
+const (
+	modName   = 0
+	modNext   = 32
+	modSize   = 44
+	modData   = 52
+	modCode   = 56
+	modImp    = 60
+	modCmd    = 64
+	modEnt    = 68
+	modPtr    = 72
+	modLength = 80
+)
+
+// The boot loader leaves the root of the module list at this address,
+// where Modules.Init picks it up.
+const rootAddr = 20
+
+// Instructions of the procedure prologue generated by the Oberon compiler:
+// SUB SP, SP, n; STW LNK, SP, 0
+const (
+	prologueSub     = 0x4EE90000
+	prologueSubMask = 0xFFFF0000
+	prologueStore   = 0xAFE00000
+)
+
+// ReadModules reads the list of modules loaded by the Oberon module loader
+// from the memory of the emulated machine. The module list is found via
+// the root pointer that the boot loader stores at address 20. Modules that
+// are loaded later are allocated contiguously after the modules of the
+// inner core, so the list is completed by walking the module blocks from
+// the lowest address upwards.
+//
+// Procedures are found by scanning the code of each module for procedure
+// prologues. Procedures that are commands are named after the command,
+// all others after their offset within the code section of the module.
+func ReadModules(mem []uint32) []Module {
+	m := memory(mem)
+	seen := make(map[uint32]bool)
+	var mods []Module
+	add := func(addr uint32) bool {
+		if seen[addr] {
+			return true
+		}
+		mod, ok := m.module(addr)
+		if !ok {
+			return false
+		}
+		seen[addr] = true
+		if mod.Name != "" {
+			mods = append(mods, mod)
+		}
+		return true
+	}
+
+	lowest := uint32(0)
+	addr := m.word(rootAddr)
+	for i := 0; addr != 0 && i < 1024 && add(addr); i++ {
+		if lowest == 0 || addr < lowest {
+			lowest = addr
+		}
+		addr = m.word(addr + modNext)
+	}
+	for addr = lowest; addr != 0 && add(addr); {
+		size := m.word(addr + modSize)
+		addr += size
+	}
+
+	slices.SortFunc(mods, func(a, b Module) int {
+		return int(int64(a.Addr) - int64(b.Addr))
+	})
+	return mods
+}
+
+type memory []uint32
+
+func (m memory) word(addr uint32) uint32 {
+	if addr%4 != 0 || int(addr/4) >= len(m) {
+		return 0
+	}
+	return m[addr/4]
+}
+
+func (m memory) byte(addr uint32) byte {
+	return byte(m.word(addr&^3) >> (addr % 4 * 8))
+}
+
+func (m memory) string(addr uint32, maxLen int) (s string, ok bool) {
+	var sb strings.Builder
+	for i := range maxLen {
+		ch := m.byte(addr + uint32(i))
+		if ch == 0 {
+			return sb.String(), true
+		}
+		if ch < ' ' || ch > '~' {
+			return "", false
+		}
+		sb.WriteByte(ch)
+	}
+	return "", false
+}
+
+// module reads the module descriptor at addr and reports whether it looks
+// like a valid descriptor. Freed modules have an empty name.
+func (m memory) module(addr uint32) (Module, bool) {
+	if addr%4 != 0 || int(addr/4)+modLength/4 > len(m) {
+		return Module{}, false
+	}
+	name, ok := m.string(addr+modName, 32)
+	if !ok {
+		return Module{}, false
+	}
+	mod := Module{
+		Name:    name,
+		Addr:    addr,
+		Size:    m.word(addr + modSize),
+		Code:    m.word(addr + modCode),
+		CodeEnd: m.word(addr + modImp),
+	}
+	end := uint64(addr) + uint64(mod.Size)
+	sections := []uint32{
+		m.word(addr + modData),
+		mod.Code,
+		mod.CodeEnd,
+		m.word(addr + modCmd),
+		m.word(addr + modEnt),
+		m.word(addr + modPtr),
+	}
+	if mod.Size < modLength || mod.Size%4 != 0 || end > uint64(len(m))*4 ||
+		!slices.IsSorted(sections) || sections[0] < addr+modLength ||
+		uint64(sections[len(sections)-1]) > end {
+		return Module{}, false
+	}
+	if name != "" {
+		mod.Procedures = m.procedures(mod, m.commands(m.word(addr+modCmd), sections[4]))
+	}
+	return mod, true
+}
+
+// commands reads the command table of a module, a sequence of
+// word-aligned, zero-terminated names, each followed by the code offset
+// of the command.
+func (m memory) commands(addr, end uint32) map[uint32]string {
+	cmds := make(map[uint32]string)
+	for addr < end && m.byte(addr) != 0 {
+		name, ok := m.string(addr, 32)
+		if !ok {
+			break
+		}
+		addr = (addr + uint32(len(name)) + 4) &^ 3
+		cmds[m.word(addr)] = name
+		addr += 4
+	}
+	return cmds
+}
+
+func (m memory) procedures(mod Module, cmds map[uint32]string) []Procedure {
+	var procs []Procedure
+	for addr := mod.Code; addr+4 < mod.CodeEnd; addr += 4 {
+		if m.word(addr)&prologueSubMask != prologueSub || m.word(addr+4) != prologueStore {
+			continue
+		}
+		offset := addr - mod.Code
+		name, ok := cmds[offset]
+		if !ok {
+			name = offsetName(offset)
+		}
+		procs = append(procs, Procedure{Name: mod.Name + "." + name, Addr: addr})
+	}
+	return procs
+}
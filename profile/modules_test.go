@@ -0,0 +1,179 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package profile
+
+import (
+	"slices"
+	"testing"
+)
+
+// testMemory builds the memory of a machine with modules loaded as by
+// the Oberon module loader.
+type testMemory []uint32
+
+func (m testMemory) putWord(addr, x uint32) {
+	m[addr/4] = x
+}
+
+func (m testMemory) putByte(addr uint32, b byte) {
+	shift := addr % 4 * 8
+	m[addr/4] = m[addr/4]&^(0xFF<<shift) | uint32(b)<<shift
+}
+
+// putString writes a zero-terminated string.
+func (m testMemory) putString(addr uint32, s string) {
+	for i := range len(s) {
+		m.putByte(addr+uint32(i), s[i])
+	}
+	m.putByte(addr+uint32(len(s)), 0)
+}
+
+type testCommand struct {
+	name   string
+	offset uint32
+}
+
+// putModule writes a module block at addr with 16 bytes of data, the
+// code words and a command table, and returns the address after it.
+func (m testMemory) putModule(addr uint32, name string, next uint32, code []uint32, cmds []testCommand) uint32 {
+	data := addr + modLength
+	codeStart := data + 16
+	codeEnd := codeStart + uint32(len(code))*4
+	for i, w := range code {
+		m.putWord(codeStart+uint32(i)*4, w)
+	}
+	cmd := codeEnd // no imports
+	p := cmd
+	for _, c := range cmds {
+		m.putString(p, c.name)
+		p = (p + uint32(len(c.name)) + 4) &^ 3
+		m.putWord(p, c.offset)
+		p += 4
+	}
+	p += 4 // end of the command table
+	ent := p
+	ptr := ent + 4
+	end := ptr + 4
+
+	m.putString(addr+modName, name)
+	m.putWord(addr+modNext, next)
+	m.putWord(addr+modSize, end-addr)
+	m.putWord(addr+modData, data)
+	m.putWord(addr+modCode, codeStart)
+	m.putWord(addr+modImp, codeEnd)
+	m.putWord(addr+modCmd, cmd)
+	m.putWord(addr+modEnt, ent)
+	m.putWord(addr+modPtr, ptr)
+	return end
+}
+
+// prologue returns the instructions of a procedure prologue.
+func prologue(frameSize uint32) []uint32 {
+	return []uint32{prologueSub | frameSize, prologueStore}
+}
+
+// code returns the code of a module with procedures of the given
+// numbers of instructions.
+func code(procSizes ...int) []uint32 {
+	var c []uint32
+	for _, n := range procSizes {
+		c = append(c, prologue(8)...)
+		for range n - 2 {
+			c = append(c, 0x40000000) // MOV R0, R0, R0
+		}
+	}
+	return c
+}
+
+// testModules returns a memory with the modules of the inner core,
+// Kernel and Modules, in the module list, and Edit loaded after them.
+// Between Modules and Edit is the block of a freed module.
+func testModules() testMemory {
+	m := make(testMemory, 0x1000)
+	const kernel = 0x400
+	modules := m.putModule(kernel, "Kernel", 0, code(4, 3), nil)
+	freed := m.putModule(modules, "Modules", kernel, code(5), []testCommand{{"Init", 0}})
+	edit := m.putModule(freed, "Gone", 0, code(2), nil)
+	m.putByte(freed+modName, 0)
+	m.putModule(edit, "Edit", 0, code(3, 4, 2), []testCommand{
+		{"Open", 0},
+		{"Show", 7 * 4},
+	})
+	m.putWord(rootAddr, modules)
+	return m
+}
+
+func TestReadModules(t *testing.T) {
+	mods := ReadModules(testModules())
+
+	var names []string
+	for _, mod := range mods {
+		names = append(names, mod.Name)
+	}
+	if want := []string{"Kernel", "Modules", "Edit"}; !slices.Equal(names, want) {
+		t.Fatalf("module names: got %v, want %v", names, want)
+	}
+
+	kernel := mods[0]
+	if kernel.Addr != 0x400 || kernel.Code != 0x400+modLength+16 || kernel.CodeEnd != kernel.Code+7*4 {
+		t.Errorf("Kernel: Addr %#x, Code %#x, CodeEnd %#x", kernel.Addr, kernel.Code, kernel.CodeEnd)
+	}
+	if mods[1].Addr != kernel.Addr+kernel.Size {
+		t.Errorf("Modules at %#x, want %#x", mods[1].Addr, kernel.Addr+kernel.Size)
+	}
+
+	tests := []struct {
+		mod   Module
+		procs []Procedure
+	}{
+		{mods[0], []Procedure{
+			{"Kernel.@0000", kernel.Code},
+			{"Kernel.@0010", kernel.Code + 16},
+		}},
+		{mods[1], []Procedure{
+			{"Modules.Init", mods[1].Code},
+		}},
+		{mods[2], []Procedure{
+			{"Edit.Open", mods[2].Code},
+			{"Edit.@000C", mods[2].Code + 12},
+			{"Edit.Show", mods[2].Code + 28},
+		}},
+	}
+	for _, tt := range tests {
+		if !slices.Equal(tt.mod.Procedures, tt.procs) {
+			t.Errorf("procedures of %s: got %v, want %v", tt.mod.Name, tt.mod.Procedures, tt.procs)
+		}
+	}
+}
+
+func TestReadModulesInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(m testMemory)
+	}{
+		{"no modules", func(m testMemory) { clear(m) }},
+		{"root outside of memory", func(m testMemory) { m.putWord(rootAddr, 0x10000) }},
+		{"name not terminated", func(m testMemory) {
+			for i := uint32(0); i < 32; i += 4 {
+				m.putWord(0x400+i, 0x41414141)
+			}
+			m.putWord(rootAddr, 0x400)
+		}},
+		{"sections out of order", func(m testMemory) {
+			m.putWord(rootAddr, 0x400)
+			m.putWord(0x400+modNext, 0)
+			m.putWord(0x400+modCode, m[(0x400+modImp)/4]+4)
+		}},
+	}
+	for _, tt := range tests {
+		m := testModules()
+		tt.modify(m)
+		for _, mod := range ReadModules(m) {
+			if mod.Addr == 0x400 {
+				t.Errorf("%s: read module %s at %#x", tt.name, mod.Name, mod.Addr)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package profile
+
+import "time"
+
+// Field numbers of the pprof profile.proto messages.
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileMapping       = 3
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	mappingID           = 1
+	mappingMemoryStart  = 2
+	mappingMemoryLimit  = 3
+	mappingFilename     = 5
+	mappingHasFunctions = 7
+
+	locationID        = 1
+	locationMappingID = 2
+	locationAddress   = 3
+	locationLine      = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID        = 1
+	functionName      = 2
+	functionStartLine = 5
+)
+
+type sample struct {
+	locations []uint64
+	count     uint64
+}
+
+type location struct {
+	addr     uint32
+	function uint64
+	line     int64
+}
+
+type profileBuilder struct {
+	start     time.Time
+	strings   []string
+	stringIDs map[string]int64
+	functions map[string]uint64
+	modules   map[string]uint64 // module name -> location ID
+	locations []location
+	samples   []sample
+}
+
+func newProfileBuilder(start time.Time) *profileBuilder {
+	return &profileBuilder{
+		start:     start,
+		strings:   []string{""},
+		stringIDs: map[string]int64{"": 0},
+		functions: make(map[string]uint64),
+		modules:   make(map[string]uint64),
+	}
+}
+
+func (b *profileBuilder) string(s string) int64 {
+	id, ok := b.stringIDs[s]
+	if !ok {
+		id = int64(len(b.strings))
+		b.strings = append(b.strings, s)
+		b.stringIDs[s] = id
+	}
+	return id
+}
+
+func (b *profileBuilder) function(name string) uint64 {
+	id, ok := b.functions[name]
+	if !ok {
+		id = uint64(len(b.functions) + 1)
+		b.functions[name] = id
+	}
+	return id
+}
+
+func (b *profileBuilder) location(addr uint32, function uint64, line int64) uint64 {
+	b.locations = append(b.locations, location{addr: addr, function: function, line: line})
+	return uint64(len(b.locations))
+}
+
+// add adds a sample for the instructions counted at byte address addr.
+func (b *profileBuilder) add(addr uint32, count uint64, mods []Module, syms *Symbols) {
+	module, proc := resolve(addr, mods, syms)
+	modLoc, ok := b.modules[module]
+	if !ok {
+		modLoc = b.location(0, b.function(module), 0)
+		b.modules[module] = modLoc
+	}
+	line := int64(addr-proc.Addr)/4 + 1
+	procLoc := b.location(addr, b.function(proc.Name), line)
+	b.samples = append(b.samples, sample{
+		locations: []uint64{procLoc, modLoc},
+		count:     count,
+	})
+}
+
+func (b *profileBuilder) encode() []byte {
+	var p protobuf
+
+	valueType := func(field int, typ, unit string) {
+		var m protobuf
+		m.int64(valueTypeType, b.string(typ))
+		m.int64(valueTypeUnit, b.string(unit))
+		p.message(field, &m)
+	}
+	valueType(profileSampleType, "instructions", "count")
+	valueType(profileSampleType, "cpu", "nanoseconds")
+
+	for _, s := range b.samples {
+		var m protobuf
+		m.packedUint64(sampleLocationID, s.locations)
+		m.packedInt64(sampleValue, []int64{int64(s.count), int64(s.count) * nanosPerInstruction})
+		p.message(profileSample, &m)
+	}
+
+	var mapping protobuf
+	mapping.uint64(mappingID, 1)
+	mapping.uint64(mappingMemoryStart, 0)
+	mapping.uint64(mappingMemoryLimit, 1<<32)
+	mapping.int64(mappingFilename, b.string("oberon"))
+	mapping.bool(mappingHasFunctions, true)
+	p.message(profileMapping, &mapping)
+
+	for i, loc := range b.locations {
+		var line protobuf
+		line.uint64(lineFunctionID, loc.function)
+		line.int64(lineLine, loc.line)
+		var m protobuf
+		m.uint64(locationID, uint64(i+1))
+		m.uint64(locationMappingID, 1)
+		m.uint64(locationAddress, uint64(loc.addr))
+		m.message(locationLine, &line)
+		p.message(profileLocation, &m)
+	}
+
+	names := make([]string, len(b.functions))
+	for name, id := range b.functions {
+		names[id-1] = name
+	}
+	for i, name := range names {
+		var m protobuf
+		m.uint64(functionID, uint64(i+1))
+		m.int64(functionName, b.string(name))
+		m.int64(functionStartLine, 1)
+		p.message(profileFunction, &m)
+	}
+
+	p.int64(profileTimeNanos, b.start.UnixNano())
+	p.int64(profileDurationNanos, int64(time.Since(b.start)))
+	valueType(profilePeriodType, "cpu", "nanoseconds")
+	p.int64(profilePeriod, nanosPerInstruction)
+
+	// The string table must be complete, so it is written last.
+	for _, s := range b.strings {
+		p.string(profileStringTable, s)
+	}
+	return p.data
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+// Package profile implements an execution profiler for the emulated
+// Project Oberon RISC machine. It counts the executed instructions per
+// address and attributes them to the loaded Oberon modules and their
+// procedures. Profiles are written in the pprof format, so they can be
+// analyzed with 'go tool pprof'.
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"slices"
+	"sort"
+	"time"
+)
+
+// The emulated processor runs at 25 MHz, one instruction per cycle.
+const nanosPerInstruction = 40
+
+// The boot ROM is at the top of the address space, or at the top of the
+// 20-bit address space if the machine decodes addresses like the FPGA.
+const (
+	romStart     = 0xFFFFF800
+	fpgaROMStart = 0x000FF800
+	fpgaROMEnd   = 0x00100000
+)
+
+// A Profile counts executed instructions per address.
+// It implements the risc.Profiler interface.
+type Profile struct {
+	start  time.Time
+	counts []uint64          // indexed by PC, for RAM
+	other  map[uint32]uint64 // for all other addresses, e.g. the boot ROM
+}
+
+// New creates a profile and starts its clock.
+func New() *Profile {
+	return &Profile{
+		start: time.Now(),
+		other: make(map[uint32]uint64),
+	}
+}
+
+// maxRAMWords limits the counter slice to the largest supported RAM size.
+const maxRAMWords = 64 << 20 / 4
+
+// Count counts an instruction executed at word address pc.
+func (p *Profile) Count(pc uint32) {
+	if pc < uint32(len(p.counts)) {
+		p.counts[pc]++
+		return
+	}
+	if pc < maxRAMWords {
+		p.counts = slices.Grow(p.counts, int(pc)+1-len(p.counts))[:pc+1]
+		p.counts[pc]++
+		return
+	}
+	p.other[pc]++
+}
+
+// Reset clears all counts and restarts the clock.
+func (p *Profile) Reset() {
+	p.start = time.Now()
+	clear(p.counts)
+	clear(p.other)
+}
+
+// Write writes the profile as a gzip-compressed pprof protocol buffer.
+// The counted addresses are attributed to the modules currently loaded in
+// the memory mem of the machine. Each sample has a two-level call stack,
+// procedure and module, which makes the module hierarchy show up in
+// flame graphs. The symbol map is optional and may be nil.
+func (p *Profile) Write(w io.Writer, mem []uint32, syms *Symbols) error {
+	mods := ReadModules(mem)
+	if syms != nil {
+		mods = syms.apply(mods)
+	}
+
+	b := newProfileBuilder(p.start)
+	for pc, n := range p.counts {
+		if n > 0 {
+			b.add(uint32(pc)*4, n, mods, syms)
+		}
+	}
+	for _, pc := range sortedKeys(p.other) {
+		b.add(pc*4, p.other[pc], mods, syms)
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.encode()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// apply adds the module-relative symbols to the procedures found
+// in the modules. User-supplied names replace generated ones.
+func (s *Symbols) apply(mods []Module) []Module {
+	for i, mod := range mods {
+		procs := make(map[uint32]string)
+		for _, proc := range mod.Procedures {
+			procs[proc.Addr] = proc.Name
+		}
+		for _, sym := range s.relative[mod.Name] {
+			procs[mod.Code+sym.Addr] = sym.Name
+		}
+		mod.Procedures = mod.Procedures[:0]
+		for _, addr := range sortedKeys(procs) {
+			mod.Procedures = append(mod.Procedures, Procedure{Name: procs[addr], Addr: addr})
+		}
+		mods[i] = mod
+	}
+	slices.SortFunc(s.absolute, func(a, b Procedure) int {
+		return int(int64(a.Addr) - int64(b.Addr))
+	})
+	return mods
+}
+
+// resolve returns the module name and the procedure for a code address.
+func resolve(addr uint32, mods []Module, syms *Symbols) (module string, proc Procedure) {
+	i := sort.Search(len(mods), func(i int) bool {
+		return mods[i].Addr > addr
+	}) - 1
+	if i >= 0 && addr < mods[i].Addr+mods[i].Size {
+		mod := mods[i]
+		procs := mod.Procedures
+		j := sort.Search(len(procs), func(j int) bool {
+			return procs[j].Addr > addr
+		}) - 1
+		if j >= 0 {
+			return mod.Name, procs[j]
+		}
+		if addr < mod.Code {
+			return mod.Name, Procedure{Name: mod.Name + ".<data>", Addr: mod.Addr}
+		}
+		return mod.Name, Procedure{Name: mod.Name + "." + offsetName(0), Addr: mod.Code}
+	}
+	module = "<unknown>"
+	if addr >= romStart || (addr >= fpgaROMStart && addr < fpgaROMEnd) {
+		module = "<boot ROM>"
+	}
+	if syms != nil {
+		abs := syms.absolute
+		j := sort.Search(len(abs), func(j int) bool {
+			return abs[j].Addr > addr
+		}) - 1
+		if j >= 0 {
+			return module, abs[j]
+		}
+	}
+	return module, Procedure{Name: module, Addr: addr}
+}
+
+func sortedKeys[V any](m map[uint32]V) []uint32 {
+	keys := make([]uint32, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,248 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"maps"
+	"testing"
+)
+
+// A protoField is a field of a decoded protocol buffer message.
+type protoField struct {
+	num   int
+	value uint64 // of a varint field
+	data  []byte // of a length-delimited field
+}
+
+func readVarint(p []byte) (x uint64, n int, err error) {
+	for shift := 0; n < len(p) && shift < 64; shift += 7 {
+		b := p[n]
+		n++
+		x |= uint64(b&0x7F) << shift
+		if b < 0x80 {
+			return x, n, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid varint % X", p)
+}
+
+func decodeMessage(p []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(p) > 0 {
+		key, n, err := readVarint(p)
+		if err != nil {
+			return nil, err
+		}
+		p = p[n:]
+		f := protoField{num: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.value, n, err = readVarint(p)
+			if err != nil {
+				return nil, err
+			}
+			p = p[n:]
+		case wireBytes:
+			size, n, err := readVarint(p)
+			if err != nil {
+				return nil, err
+			}
+			p = p[n:]
+			if size > uint64(len(p)) {
+				return nil, fmt.Errorf("field %d: length %d exceeds message", f.num, size)
+			}
+			f.data, p = p[:size], p[size:]
+		default:
+			return nil, fmt.Errorf("field %d: unexpected wire type %d", f.num, key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func decodePacked(p []byte) ([]uint64, error) {
+	var xs []uint64
+	for len(p) > 0 {
+		x, n, err := readVarint(p)
+		if err != nil {
+			return nil, err
+		}
+		xs = append(xs, x)
+		p = p[n:]
+	}
+	return xs, nil
+}
+
+// decodedProfile is the content of a pprof profile that the tests check.
+type decodedProfile struct {
+	strings []string
+	period  int64
+	// instruction counts by the names of the functions of the sample
+	// locations, e.g. "Edit.Open <- Edit"
+	counts map[string]uint64
+}
+
+func decodeProfile(t *testing.T, data []byte) *decodedProfile {
+	t.Helper()
+	must := func(fields []protoField, err error) []protoField {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fields
+	}
+	top := must(decodeMessage(data))
+
+	p := &decodedProfile{counts: make(map[string]uint64)}
+	functions := make(map[uint64]uint64) // ID -> name index
+	locations := make(map[uint64]uint64) // ID -> function ID
+	var samples [][]protoField
+	for _, f := range top {
+		switch f.num {
+		case profileStringTable:
+			p.strings = append(p.strings, string(f.data))
+		case profilePeriod:
+			p.period = int64(f.value)
+		case profileSample:
+			samples = append(samples, must(decodeMessage(f.data)))
+		case profileFunction:
+			var id, name uint64
+			for _, g := range must(decodeMessage(f.data)) {
+				switch g.num {
+				case functionID:
+					id = g.value
+				case functionName:
+					name = g.value
+				}
+			}
+			functions[id] = name
+		case profileLocation:
+			var id, function uint64
+			for _, g := range must(decodeMessage(f.data)) {
+				switch g.num {
+				case locationID:
+					id = g.value
+				case locationLine:
+					for _, h := range must(decodeMessage(g.data)) {
+						if h.num == lineFunctionID {
+							function = h.value
+						}
+					}
+				}
+			}
+			locations[id] = function
+		}
+	}
+	if len(p.strings) == 0 || p.strings[0] != "" {
+		t.Fatalf("string table %q doesn't start with the empty string", p.strings)
+	}
+	for _, s := range samples {
+		var stack string
+		var values []uint64
+		for _, f := range s {
+			xs, err := decodePacked(f.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch f.num {
+			case sampleLocationID:
+				for i, loc := range xs {
+					if i > 0 {
+						stack += " <- "
+					}
+					stack += p.strings[functions[locations[loc]]]
+				}
+			case sampleValue:
+				values = xs
+			}
+		}
+		if len(values) != 2 || values[1] != values[0]*nanosPerInstruction {
+			t.Errorf("sample %s: values %v, want count and nanoseconds", stack, values)
+			continue
+		}
+		p.counts[stack] += values[0]
+	}
+	return p
+}
+
+func TestProfileWrite(t *testing.T) {
+	mem := testModules()
+	mods := ReadModules(mem)
+	kernel, edit := mods[0], mods[2]
+
+	p := New()
+	count := func(addr uint32, n int) {
+		for range n {
+			p.Count(addr / 4)
+		}
+	}
+	count(kernel.Code+4, 3)  // Kernel.New
+	count(kernel.Code+20, 1) // Kernel.Collect
+	count(edit.Code, 2)      // Edit.Open
+	count(edit.Code+12, 5)   // Edit.@000C
+	count(edit.Code+0x20, 4) // Edit.Locate
+	count(kernel.Addr+4, 1)  // Kernel data
+	count(0xFFFFF804, 7)     // BootLoad
+	count(0xFFFFF904, 6)     // LoadFromDisk
+	count(0x00080000, 1)     // outside of the modules
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf, mem, readTestSymbols(t)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := decodeProfile(t, data)
+
+	if got.period != nanosPerInstruction {
+		t.Errorf("period: got %d, want %d", got.period, nanosPerInstruction)
+	}
+	want := map[string]uint64{
+		"Kernel.New <- Kernel":       3,
+		"Kernel.Collect <- Kernel":   1,
+		"Edit.Open <- Edit":          2,
+		"Edit.@000C <- Edit":         5,
+		"Edit.Locate <- Edit":        4,
+		"Kernel.<data> <- Kernel":    1,
+		"BootLoad <- <boot ROM>":     7,
+		"LoadFromDisk <- <boot ROM>": 6,
+		"<unknown> <- <unknown>":     1,
+	}
+	if !maps.Equal(got.counts, want) {
+		t.Errorf("counts:\ngot  %v\nwant %v", got.counts, want)
+	}
+}
+
+func TestProfileReset(t *testing.T) {
+	p := New()
+	p.Count(0x100)
+	p.Count(romStart / 4)
+	p.Reset()
+	var buf bytes.Buffer
+	if err := p.Write(&buf, testModules(), nil); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decodeProfile(t, data); len(got.counts) != 0 {
+		t.Errorf("counts after Reset: %v", got.counts)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package profile
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProtobufVarint(t *testing.T) {
+	tests := []struct {
+		x    uint64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{300, []byte{0xAC, 0x02}},
+		{1<<32 - 1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F}},
+		{1<<64 - 1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}},
+	}
+	for _, tt := range tests {
+		var b protobuf
+		b.varint(tt.x)
+		if !bytes.Equal(b.data, tt.want) {
+			t.Errorf("varint(%d) = % X, want % X", tt.x, b.data, tt.want)
+		}
+	}
+}
+
+func TestProtobufFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(b *protobuf)
+		want  []byte
+	}{
+		{"uint64", func(b *protobuf) { b.uint64(1, 150) }, []byte{0x08, 0x96, 0x01}},
+		{"zero uint64 is omitted", func(b *protobuf) { b.uint64(1, 0) }, nil},
+		{"negative int64", func(b *protobuf) { b.int64(2, -1) },
+			[]byte{0x10, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}},
+		{"true", func(b *protobuf) { b.bool(7, true) }, []byte{0x38, 0x01}},
+		{"false is omitted", func(b *protobuf) { b.bool(7, false) }, nil},
+		{"string", func(b *protobuf) { b.string(6, "cpu") }, []byte{0x32, 0x03, 'c', 'p', 'u'}},
+		{"empty string", func(b *protobuf) { b.string(6, "") }, []byte{0x32, 0x00}},
+		{"packed uint64", func(b *protobuf) { b.packedUint64(1, []uint64{3, 270}) },
+			[]byte{0x0A, 0x03, 0x03, 0x8E, 0x02}},
+		{"packed int64", func(b *protobuf) { b.packedInt64(2, []int64{1, 40}) },
+			[]byte{0x12, 0x02, 0x01, 0x28}},
+		{"large field number", func(b *protobuf) { b.uint64(16, 1) }, []byte{0x80, 0x01, 0x01}},
+		{"message", func(b *protobuf) {
+			var m protobuf
+			m.uint64(1, 2)
+			b.message(4, &m)
+		}, []byte{0x22, 0x02, 0x08, 0x02}},
+	}
+	for _, tt := range tests {
+		var b protobuf
+		tt.write(&b)
+		if !bytes.Equal(b.data, tt.want) {
+			t.Errorf("%s: got % X, want % X", tt.name, b.data, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package profile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Symbols is a user-supplied symbol map that names code addresses.
+//
+// Each line of a symbol map has one of the following forms:
+//
+//	MODULE OFFSET NAME
+//	ADDRESS NAME
+//
+// The first form names the procedure at the hexadecimal byte OFFSET within
+// the code section of the module MODULE, wherever the module is loaded.
+// The second form names the code at the absolute hexadecimal byte ADDRESS,
+// e.g. in the boot ROM. Empty lines and lines starting with '#' are ignored.
+type Symbols struct {
+	relative map[string][]Procedure
+	absolute []Procedure
+}
+
+// ReadSymbols parses a symbol map.
+func ReadSymbols(r io.Reader) (*Symbols, error) {
+	syms := &Symbols{relative: make(map[string][]Procedure)}
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		switch len(fields) {
+		case 2:
+			addr, err := parseHex(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid address: %w", line, err)
+			}
+			syms.absolute = append(syms.absolute, Procedure{Name: fields[1], Addr: addr})
+		case 3:
+			offset, err := parseHex(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid offset: %w", line, err)
+			}
+			mod := fields[0]
+			name := fields[2]
+			if !strings.Contains(name, ".") {
+				name = mod + "." + name
+			}
+			syms.relative[mod] = append(syms.relative[mod], Procedure{Name: name, Addr: offset})
+		default:
+			return nil, fmt.Errorf("line %d: expected 2 or 3 fields, got %d", line, len(fields))
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return syms, nil
+}
+
+func parseHex(s string) (uint32, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "H"), "h")
+	x, err := strconv.ParseUint(s, 16, 32)
+	return uint32(x), err
+}
+
+func offsetName(offset uint32) string {
+	return fmt.Sprintf("@%04X", offset)
+}
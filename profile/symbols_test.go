@@ -0,0 +1,91 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package profile
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func readTestSymbols(t *testing.T) *Symbols {
+	t.Helper()
+	f, err := os.Open("testdata/example.sym")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	syms, err := ReadSymbols(f)
+	if err != nil {
+		t.Fatalf("ReadSymbols: %v", err)
+	}
+	return syms
+}
+
+func TestReadSymbols(t *testing.T) {
+	syms := readTestSymbols(t)
+
+	wantRelative := map[string][]Procedure{
+		"Kernel": {{"Kernel.New", 0}, {"Kernel.Collect", 0x10}},
+		"Edit":   {{"Edit.Locate", 0x20}},
+	}
+	if len(syms.relative) != len(wantRelative) {
+		t.Errorf("got symbols for %d modules, want %d", len(syms.relative), len(wantRelative))
+	}
+	for mod, want := range wantRelative {
+		if got := syms.relative[mod]; !slices.Equal(got, want) {
+			t.Errorf("symbols of %s: got %v, want %v", mod, got, want)
+		}
+	}
+	wantAbsolute := []Procedure{{"BootLoad", 0xFFFFF800}, {"LoadFromDisk", 0xFFFFF900}}
+	if !slices.Equal(syms.absolute, wantAbsolute) {
+		t.Errorf("absolute symbols: got %v, want %v", syms.absolute, wantAbsolute)
+	}
+}
+
+func TestReadSymbolsErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Kernel 0 New\nKernel\n", "line 2: expected 2 or 3 fields, got 1"},
+		{"Kernel 0 New extra words\n", "line 1: expected 2 or 3 fields, got 5"},
+		{"# comment\n\nXYZ BootLoad\n", "line 3: invalid address"},
+		{"Kernel 0x1G New\n", "line 1: invalid offset"},
+		{"100000000 TooHigh\n", "line 1: invalid address"},
+	}
+	for _, tt := range tests {
+		_, err := ReadSymbols(strings.NewReader(tt.input))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("ReadSymbols(%q): got error %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestSymbolsApply(t *testing.T) {
+	syms := readTestSymbols(t)
+	mods := syms.apply(ReadModules(testModules()))
+
+	kernel := mods[0]
+	wantKernel := []Procedure{
+		{"Kernel.New", kernel.Code},
+		{"Kernel.Collect", kernel.Code + 0x10},
+	}
+	if !slices.Equal(kernel.Procedures, wantKernel) {
+		t.Errorf("procedures of Kernel: got %v, want %v", kernel.Procedures, wantKernel)
+	}
+	// A symbol between the procedures found in the code is added.
+	edit := mods[2]
+	wantEdit := []Procedure{
+		{"Edit.Open", edit.Code},
+		{"Edit.@000C", edit.Code + 12},
+		{"Edit.Show", edit.Code + 28},
+		{"Edit.Locate", edit.Code + 0x20},
+	}
+	if !slices.Equal(edit.Procedures, wantEdit) {
+		t.Errorf("procedures of Edit: got %v, want %v", edit.Procedures, wantEdit)
+	}
+}
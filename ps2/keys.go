@@ -0,0 +1,183 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package ps2
+
+// RightShift is the right Shift key, see LeftShift.
+var RightShift = Key{Code: 0x59}
+
+// keyKind tells how a keyboard sends a key besides its make and break
+// codes.
+type keyKind uint8
+
+const (
+	plainKey keyKind = iota
+	// The navigation keys are sent as by a keyboard with Num Lock on:
+	// with a fake Shift press before the make code and a fake Shift
+	// release after the break code.
+	numLockKey
+	// The key is sent with fake releases of the held Shift keys before
+	// the make code and fake presses after the break code.
+	unshiftedKey
+)
+
+// Make returns the command sequence that the keyboard sends when the key
+// is pressed while holding the given Shift keys.
+func (k Key) Make(shifts ...Key) []byte {
+	var out []byte
+	switch k.kind {
+	case numLockKey:
+		out = append(out, fake(LeftShift).Press()...)
+	case unshiftedKey:
+		for _, s := range shifts {
+			out = append(out, fake(s).Release()...)
+		}
+	}
+	return append(out, k.Press()...)
+}
+
+// Break returns the command sequence that the keyboard sends when the
+// key is released while holding the given Shift keys.
+func (k Key) Break(shifts ...Key) []byte {
+	out := k.Release()
+	switch k.kind {
+	case numLockKey:
+		out = append(out, fake(LeftShift).Release()...)
+	case unshiftedKey:
+		for i := len(shifts) - 1; i >= 0; i-- {
+			out = append(out, fake(shifts[i]).Press()...)
+		}
+	}
+	return out
+}
+
+// fake returns the key with the extended code that a keyboard sends for
+// a Shift key it didn't press or release itself.
+func fake(shift Key) Key {
+	return Key{Code: shift.Code, Extended: true}
+}
+
+// KeyByCode returns the key at a position of the keyboard. The position
+// is named like the code attribute of a keyboard event in the W3C UI
+// Events, e.g. "KeyA", "Digit1", "Enter" or "ArrowLeft", after the key
+// at that position of a US keyboard.
+func KeyByCode(code string) (Key, bool) {
+	k, ok := keysByCode[code]
+	return k, ok
+}
+
+// keysByCode contains the keys of a PS/2 keyboard by the names of their
+// positions, see KeyByCode.
+var keysByCode = map[string]Key{
+	"KeyA": {Code: 0x1C},
+	"KeyB": {Code: 0x32},
+	"KeyC": {Code: 0x21},
+	"KeyD": {Code: 0x23},
+	"KeyE": {Code: 0x24},
+	"KeyF": {Code: 0x2B},
+	"KeyG": {Code: 0x34},
+	"KeyH": {Code: 0x33},
+	"KeyI": {Code: 0x43},
+	"KeyJ": {Code: 0x3B},
+	"KeyK": {Code: 0x42},
+	"KeyL": {Code: 0x4B},
+	"KeyM": {Code: 0x3A},
+	"KeyN": {Code: 0x31},
+	"KeyO": {Code: 0x44},
+	"KeyP": {Code: 0x4D},
+	"KeyQ": {Code: 0x15},
+	"KeyR": {Code: 0x2D},
+	"KeyS": {Code: 0x1B},
+	"KeyT": {Code: 0x2C},
+	"KeyU": {Code: 0x3C},
+	"KeyV": {Code: 0x2A},
+	"KeyW": {Code: 0x1D},
+	"KeyX": {Code: 0x22},
+	"KeyY": {Code: 0x35},
+	"KeyZ": {Code: 0x1A},
+
+	"Digit1": {Code: 0x16},
+	"Digit2": {Code: 0x1E},
+	"Digit3": {Code: 0x26},
+	"Digit4": {Code: 0x25},
+	"Digit5": {Code: 0x2E},
+	"Digit6": {Code: 0x36},
+	"Digit7": {Code: 0x3D},
+	"Digit8": {Code: 0x3E},
+	"Digit9": {Code: 0x46},
+	"Digit0": {Code: 0x45},
+
+	"Enter":     {Code: 0x5A},
+	"Escape":    {Code: 0x76},
+	"Backspace": {Code: 0x66},
+	"Tab":       {Code: 0x0D},
+	"Space":     {Code: 0x29},
+
+	"Minus":        {Code: 0x4E},
+	"Equal":        {Code: 0x55},
+	"BracketLeft":  {Code: 0x54},
+	"BracketRight": {Code: 0x5B},
+	"Backslash":    {Code: 0x5D},
+	"Semicolon":    {Code: 0x4C},
+	"Quote":        {Code: 0x52},
+	"Backquote":    {Code: 0x0E},
+	"Comma":        {Code: 0x41},
+	"Period":       {Code: 0x49},
+	"Slash":        {Code: 0x4A},
+
+	"F1":  {Code: 0x05},
+	"F2":  {Code: 0x06},
+	"F3":  {Code: 0x04},
+	"F4":  {Code: 0x0C},
+	"F5":  {Code: 0x03},
+	"F6":  {Code: 0x0B},
+	"F7":  {Code: 0x83},
+	"F8":  {Code: 0x0A},
+	"F9":  {Code: 0x01},
+	"F10": {Code: 0x09},
+	"F11": {Code: 0x78},
+	"F12": {Code: 0x07},
+
+	// Most of the keys below are not used by Oberon
+
+	"Insert":     {Code: 0x70, Extended: true, kind: numLockKey},
+	"Home":       {Code: 0x6C, Extended: true, kind: numLockKey},
+	"PageUp":     {Code: 0x7D, Extended: true, kind: numLockKey},
+	"Delete":     {Code: 0x71, Extended: true, kind: numLockKey},
+	"End":        {Code: 0x69, Extended: true, kind: numLockKey},
+	"PageDown":   {Code: 0x7A, Extended: true, kind: numLockKey},
+	"ArrowRight": {Code: 0x74, Extended: true, kind: numLockKey},
+	"ArrowLeft":  {Code: 0x68, Extended: true, kind: numLockKey},
+	"ArrowDown":  {Code: 0x72, Extended: true, kind: numLockKey},
+	"ArrowUp":    {Code: 0x75, Extended: true, kind: numLockKey},
+
+	"NumpadDivide":   {Code: 0x4A, Extended: true, kind: unshiftedKey},
+	"NumpadMultiply": {Code: 0x7C},
+	"NumpadSubtract": {Code: 0x7B},
+	"NumpadAdd":      {Code: 0x79},
+	"NumpadEnter":    {Code: 0x5A, Extended: true},
+	"Numpad1":        {Code: 0x69},
+	"Numpad2":        {Code: 0x72},
+	"Numpad3":        {Code: 0x7A},
+	"Numpad4":        {Code: 0x6B},
+	"Numpad5":        {Code: 0x73},
+	"Numpad6":        {Code: 0x74},
+	"Numpad7":        {Code: 0x6C},
+	"Numpad8":        {Code: 0x75},
+	"Numpad9":        {Code: 0x7D},
+	"Numpad0":        {Code: 0x70},
+	"NumpadDecimal":  {Code: 0x71},
+
+	"IntlBackslash": {Code: 0x61},
+	"ContextMenu":   {Code: 0x2F, Extended: true},
+
+	"ControlLeft":  {Code: 0x14},
+	"ShiftLeft":    LeftShift,
+	"AltLeft":      {Code: 0x11},
+	"MetaLeft":     {Code: 0x1F, Extended: true},
+	"ControlRight": {Code: 0x14, Extended: true},
+	"ShiftRight":   RightShift,
+	"AltRight":     AltGr,
+	"MetaRight":    {Code: 0x27, Extended: true},
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package ps2_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fzipp/oberon/ps2"
+)
+
+func TestKeyMakeBreak(t *testing.T) {
+	tests := []struct {
+		code      string
+		shifts    []ps2.Key
+		wantMake  []byte
+		wantBreak []byte
+	}{
+		{"KeyA", nil, []byte{0x1C}, []byte{0xF0, 0x1C}},
+		{"KeyA", []ps2.Key{ps2.LeftShift}, []byte{0x1C}, []byte{0xF0, 0x1C}},
+		{"F7", nil, []byte{0x83}, []byte{0xF0, 0x83}},
+		{"ShiftRight", nil, []byte{0x59}, []byte{0xF0, 0x59}},
+		{"AltRight", nil, []byte{0xE0, 0x11}, []byte{0xE0, 0xF0, 0x11}},
+		{"NumpadEnter", nil, []byte{0xE0, 0x5A}, []byte{0xE0, 0xF0, 0x5A}},
+		// Navigation keys as with Num Lock on
+		{"ArrowLeft", nil,
+			[]byte{0xE0, 0x12, 0xE0, 0x68},
+			[]byte{0xE0, 0xF0, 0x68, 0xE0, 0xF0, 0x12}},
+		{"Delete", nil,
+			[]byte{0xE0, 0x12, 0xE0, 0x71},
+			[]byte{0xE0, 0xF0, 0x71, 0xE0, 0xF0, 0x12}},
+		// The divide key of the keypad without the held Shift keys
+		{"NumpadDivide", nil, []byte{0xE0, 0x4A}, []byte{0xE0, 0xF0, 0x4A}},
+		{"NumpadDivide", []ps2.Key{ps2.LeftShift, ps2.RightShift},
+			[]byte{0xE0, 0xF0, 0x12, 0xE0, 0xF0, 0x59, 0xE0, 0x4A},
+			[]byte{0xE0, 0xF0, 0x4A, 0xE0, 0x59, 0xE0, 0x12}},
+	}
+	for _, tt := range tests {
+		k, ok := ps2.KeyByCode(tt.code)
+		if !ok {
+			t.Errorf("KeyByCode(%q): not found", tt.code)
+			continue
+		}
+		if got := k.Make(tt.shifts...); !bytes.Equal(got, tt.wantMake) {
+			t.Errorf("%s: Make(%v) = % X, want % X", tt.code, tt.shifts, got, tt.wantMake)
+		}
+		if got := k.Break(tt.shifts...); !bytes.Equal(got, tt.wantBreak) {
+			t.Errorf("%s: Break(%v) = % X, want % X", tt.code, tt.shifts, got, tt.wantBreak)
+		}
+	}
+	if k, ok := ps2.KeyByCode("Fn"); ok {
+		t.Errorf("KeyByCode(%q) = %v, want none", "Fn", k)
+	}
+}
+
+// The letter keys are at the same positions as in the US layout.
+func TestKeyByCodeLetters(t *testing.T) {
+	for r := 'a'; r <= 'z'; r++ {
+		code := "Key" + string(r-'a'+'A')
+		k, ok := ps2.KeyByCode(code)
+		strokes, _ := ps2.US.Strokes(r)
+		if !ok || len(strokes) != 1 || strokes[0].Key != k {
+			t.Errorf("KeyByCode(%q) = %v, %v; want the key typing %q: %v", code, k, ok, r, strokes)
+		}
+	}
+}
+
+func TestLayoutEncodeKeysym(t *testing.T) {
+	tests := []struct {
+		layout    *ps2.Layout
+		keysym    uint32
+		wantMake  []byte
+		wantBreak []byte
+	}{
+		{ps2.US, 'a', []byte{0x1C, 0xF0, 0x1C}, nil},
+		{ps2.US, 'A', []byte{0x12, 0x1C, 0xF0, 0x1C, 0xF0, 0x12}, nil},
+		{ps2.German, 'z', []byte{0x35, 0xF0, 0x35}, nil},
+		{ps2.German, 0xE4, []byte{0x52, 0xF0, 0x52}, nil},  // ä
+		{ps2.US, 0x010020AC, nil, nil},                     // € is not in Oberon's character set
+		{ps2.US, 0xFF0D, []byte{0x5A}, []byte{0xF0, 0x5A}}, // Return
+		{ps2.US, 0xFFC9, []byte{0x07}, []byte{0xF0, 0x07}}, // F12
+		{ps2.US, 0xFFE1, nil, nil},                         // Shift_L
+		{ps2.US, 0xFF52, // Up
+			[]byte{0xE0, 0x12, 0xE0, 0x75},
+			[]byte{0xE0, 0xF0, 0x75, 0xE0, 0xF0, 0x12}},
+	}
+	for _, tt := range tests {
+		if got := tt.layout.EncodeKeysym(tt.keysym, true); !bytes.Equal(got, tt.wantMake) {
+			t.Errorf("%s: EncodeKeysym(%#x, true) = % X, want % X", tt.layout.Name, tt.keysym, got, tt.wantMake)
+		}
+		if got := tt.layout.EncodeKeysym(tt.keysym, false); !bytes.Equal(got, tt.wantBreak) {
+			t.Errorf("%s: EncodeKeysym(%#x, false) = % X, want % X", tt.layout.Name, tt.keysym, got, tt.wantBreak)
+		}
+	}
+}
+
+func TestKeysymRune(t *testing.T) {
+	tests := []struct {
+		keysym uint32
+		want   rune
+		ok     bool
+	}{
+		{'a', 'a', true},
+		{' ', ' ', true},
+		{0xE9, 'é', true},
+		{0x010020AC, '€', true},
+		{0x1F, 0, false},
+		{0xFF0D, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ps2.KeysymRune(tt.keysym)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("KeysymRune(%#x) = %q, %v; want %q, %v", tt.keysym, got, ok, tt.want, tt.ok)
+		}
+	}
+}
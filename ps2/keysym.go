@@ -0,0 +1,79 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package ps2
+
+// EncodeKeysym translates an X11 keysym, as sent in the key events of
+// the Remote Framebuffer Protocol, into a PS/2 keyboard command sequence.
+// The 'make' parameter indicates if the key is pressed (true) or released
+// (false).
+//
+// Keysyms of characters are passed in character mode: the character is
+// typed with the layout when the key is pressed, and nothing is sent
+// when it is released. The keysym already reflects the state of the
+// Shift key, so the Shift keys themselves are not passed.
+func (l *Layout) EncodeKeysym(keysym uint32, make bool) []byte {
+	if r, ok := KeysymRune(keysym); ok {
+		if !make {
+			return nil
+		}
+		out, _ := l.Encode(r)
+		return out
+	}
+	k, ok := KeyByCode(keysymCodes[keysym])
+	switch {
+	case !ok:
+		return nil
+	case make:
+		return k.Make()
+	default:
+		return k.Break()
+	}
+}
+
+// KeysymRune returns the character typed by a keysym. The printable
+// Latin-1 characters have their code point as keysym, the other Unicode
+// characters their code point plus 0x01000000.
+func KeysymRune(keysym uint32) (rune, bool) {
+	switch {
+	case 0x20 <= keysym && keysym <= 0x7E, 0xA0 <= keysym && keysym <= 0xFF:
+		return rune(keysym), true
+	case 0x01000100 <= keysym && keysym <= 0x0110FFFF:
+		return rune(keysym - 0x01000000), true
+	}
+	return 0, false
+}
+
+// keysymCodes contains the keysyms of the keys that don't type a
+// character, with the names of the key positions, see KeyByCode.
+var keysymCodes = map[uint32]string{
+	0xFF0D: "Enter",
+	0xFF1B: "Escape",
+	0xFF08: "Backspace",
+	0xFF09: "Tab",
+
+	0xFFBE: "F1",
+	0xFFBF: "F2",
+	0xFFC0: "F3",
+	0xFFC1: "F4",
+	0xFFC2: "F5",
+	0xFFC3: "F6",
+	0xFFC4: "F7",
+	0xFFC5: "F8",
+	0xFFC6: "F9",
+	0xFFC7: "F10",
+	0xFFC8: "F11",
+	0xFFC9: "F12",
+
+	0xFF63: "Insert",
+	0xFF50: "Home",
+	0xFF55: "PageUp",
+	0xFFFF: "Delete",
+	0xFF57: "End",
+	0xFF56: "PageDown",
+	0xFF53: "ArrowRight",
+	0xFF51: "ArrowLeft",
+	0xFF54: "ArrowDown",
+	0xFF52: "ArrowUp",
+}
@@ -0,0 +1,241 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package ps2
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/fzipp/oberon/charset"
+)
+
+// A Layout maps characters to the key strokes that type them with a
+// keyboard driver for the layout. It only contains the characters of
+// Oberon's character set: ASCII and the accented letters of the
+// extended character set.
+type Layout struct {
+	Name    string // short name, e.g. "de"
+	Title   string // descriptive name, e.g. "German"
+	strokes map[rune][]Stroke
+}
+
+// Strokes returns the key strokes that type a character, or false if
+// the character can't be typed with the layout. Characters with an
+// accent may take two strokes: a dead key and the base character.
+func (l *Layout) Strokes(r rune) ([]Stroke, bool) {
+	s, ok := l.strokes[r]
+	return s, ok
+}
+
+// Encode returns the command sequence that types a character, or false
+// if the character can't be typed with the layout.
+func (l *Layout) Encode(r rune) ([]byte, bool) {
+	strokes, ok := l.strokes[r]
+	if !ok {
+		return nil, false
+	}
+	var out []byte
+	for _, s := range strokes {
+		out = append(out, s.Encode()...)
+	}
+	return out, true
+}
+
+// Layouts are the available keyboard layouts.
+var Layouts = []*Layout{US, German, SwissGerman}
+
+// Keyboard layouts of Oberon's keyboard driver. US is the layout of the
+// standard driver of Project Oberon. German and SwissGerman need a driver
+// with that layout and its dead keys, which Project Oberon doesn't have.
+var (
+	US          = newLayout("us", "US", usKeys, "")
+	German      = newLayout("de", "German", germanKeys, "^´`")
+	SwissGerman = newLayout("ch", "Swiss German", swissGermanKeys, "^`´¨~")
+)
+
+// LayoutByName returns the keyboard layout with a short name.
+func LayoutByName(name string) (*Layout, error) {
+	var names []string
+	for _, l := range Layouts {
+		if strings.EqualFold(l.Name, name) {
+			return l, nil
+		}
+		names = append(names, l.Name)
+	}
+	return nil, fmt.Errorf("unknown keyboard layout %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// A keyDef defines the characters of a key: without modifiers, with
+// Shift, and with AltGr. A zero rune means the key types no character.
+type keyDef struct {
+	code                 byte
+	normal, shift, altGr rune
+}
+
+// letter defines a letter key typing the upper case letter with Shift.
+func letter(code byte, r rune) keyDef {
+	return keyDef{code, r, unicode.ToUpper(r), 0}
+}
+
+// controlKeys type the same characters in all layouts.
+var controlKeys = []keyDef{
+	{0x5A, '\r', 0, 0}, // Enter
+	{0x0D, '\t', 0, 0}, // Tab
+	{0x66, '\b', 0, 0}, // Backspace
+	{0x76, 0x1B, 0, 0}, // Escape
+	{0x29, ' ', 0, 0},  // Space
+}
+
+// letterKeys are the letter keys that are in the same place in all
+// layouts; the layouts add y and z.
+var letterKeys = []keyDef{
+	letter(0x1C, 'a'), letter(0x32, 'b'), letter(0x21, 'c'),
+	letter(0x23, 'd'), letter(0x24, 'e'), letter(0x2B, 'f'),
+	letter(0x34, 'g'), letter(0x33, 'h'), letter(0x43, 'i'),
+	letter(0x3B, 'j'), letter(0x42, 'k'), letter(0x4B, 'l'),
+	letter(0x3A, 'm'), letter(0x31, 'n'), letter(0x44, 'o'),
+	letter(0x4D, 'p'), letter(0x15, 'q'), letter(0x2D, 'r'),
+	letter(0x1B, 's'), letter(0x2C, 't'), letter(0x3C, 'u'),
+	letter(0x2A, 'v'), letter(0x1D, 'w'), letter(0x22, 'x'),
+}
+
+var usKeys = []keyDef{
+	letter(0x35, 'y'), letter(0x1A, 'z'),
+	{0x0E, '`', '~', 0},
+	{0x16, '1', '!', 0},
+	{0x1E, '2', '@', 0},
+	{0x26, '3', '#', 0},
+	{0x25, '4', '$', 0},
+	{0x2E, '5', '%', 0},
+	{0x36, '6', '^', 0},
+	{0x3D, '7', '&', 0},
+	{0x3E, '8', '*', 0},
+	{0x46, '9', '(', 0},
+	{0x45, '0', ')', 0},
+	{0x4E, '-', '_', 0},
+	{0x55, '=', '+', 0},
+	{0x54, '[', '{', 0},
+	{0x5B, ']', '}', 0},
+	{0x5D, '\\', '|', 0},
+	{0x4C, ';', ':', 0},
+	{0x52, '\'', '"', 0},
+	{0x41, ',', '<', 0},
+	{0x49, '.', '>', 0},
+	{0x4A, '/', '?', 0},
+}
+
+var germanKeys = []keyDef{
+	letter(0x1A, 'y'), letter(0x35, 'z'),
+	{0x15, 'q', 'Q', '@'},
+	{0x0E, '^', '°', 0},
+	{0x16, '1', '!', 0},
+	{0x1E, '2', '"', '²'},
+	{0x26, '3', '§', '³'},
+	{0x25, '4', '$', 0},
+	{0x2E, '5', '%', 0},
+	{0x36, '6', '&', 0},
+	{0x3D, '7', '/', '{'},
+	{0x3E, '8', '(', '['},
+	{0x46, '9', ')', ']'},
+	{0x45, '0', '=', '}'},
+	{0x4E, 'ß', '?', '\\'},
+	{0x55, '´', '`', 0},
+	{0x54, 'ü', 'Ü', 0},
+	{0x5B, '+', '*', '~'},
+	{0x4C, 'ö', 'Ö', 0},
+	{0x52, 'ä', 'Ä', 0},
+	{0x5D, '#', '\'', 0},
+	{0x61, '<', '>', '|'},
+	{0x41, ',', ';', 0},
+	{0x49, '.', ':', 0},
+	{0x4A, '-', '_', 0},
+}
+
+var swissGermanKeys = []keyDef{
+	letter(0x1A, 'y'), letter(0x35, 'z'),
+	{0x0E, '§', '°', 0},
+	{0x16, '1', '+', '¦'},
+	{0x1E, '2', '"', '@'},
+	{0x26, '3', '*', '#'},
+	{0x25, '4', 'ç', 0},
+	{0x2E, '5', '%', 0},
+	{0x36, '6', '&', '¬'},
+	{0x3D, '7', '/', '|'},
+	{0x3E, '8', '(', '¢'},
+	{0x46, '9', ')', 0},
+	{0x45, '0', '=', 0},
+	{0x4E, '\'', '?', '´'},
+	{0x55, '^', '`', '~'},
+	{0x54, 'ü', 'è', '['},
+	{0x5B, '¨', '!', ']'},
+	{0x4C, 'ö', 'é', 0},
+	{0x52, 'ä', 'à', '{'},
+	{0x5D, '$', '£', '}'},
+	{0x61, '<', '>', '\\'},
+	{0x41, ',', ';', 0},
+	{0x49, '.', ':', 0},
+	{0x4A, '-', '_', 0},
+}
+
+// accents maps the accent of a dead key to pairs of base and accented
+// characters.
+var accents = map[rune]string{
+	'^': "aâeêiîoôuûAÂEÊIÎOÔUÛ",
+	'`': "aàeèiìoòuùAÀEÈIÌOÒUÙ",
+	'´': "aáeéiíoóuúAÁEÉIÍOÓUÚ",
+	'¨': "aäeëiïoöuüyÿAÄEËIÏOÖUÜ",
+	'~': "aãnñoõAÃNÑOÕ",
+}
+
+func isOberonChar(r rune) bool {
+	_, ok := charset.Byte(r)
+	return ok
+}
+
+// newLayout creates a layout from the definitions of its keys. The
+// characters in dead are typed by dead keys: alone they are followed
+// by a space, and they put an accent on the character typed next.
+func newLayout(name, title string, keys []keyDef, dead string) *Layout {
+	all := make(map[rune]Stroke)
+	add := func(r rune, s Stroke) {
+		if _, ok := all[r]; r != 0 && !ok {
+			all[r] = s
+		}
+	}
+	for _, defs := range [][]keyDef{controlKeys, letterKeys, keys} {
+		for _, k := range defs {
+			key := Key{Code: k.code}
+			add(k.normal, Stroke{Key: key})
+			add(k.shift, Stroke{Key: key, Mods: Shift})
+			add(k.altGr, Stroke{Key: key, Mods: AltGraph})
+		}
+	}
+	add('\n', all['\r'])
+
+	l := &Layout{Name: name, Title: title, strokes: make(map[rune][]Stroke)}
+	for r, s := range all {
+		if isOberonChar(r) && !strings.ContainsRune(dead, r) {
+			l.strokes[r] = []Stroke{s}
+		}
+	}
+	for _, accent := range dead {
+		deadKey := all[accent]
+		if isOberonChar(accent) {
+			l.strokes[accent] = []Stroke{deadKey, all[' ']}
+		}
+		pairs := []rune(accents[accent])
+		for i := 0; i+1 < len(pairs); i += 2 {
+			base, accented := pairs[i], pairs[i+1]
+			if _, ok := l.strokes[accented]; ok || !isOberonChar(accented) {
+				continue
+			}
+			if s, ok := all[base]; ok {
+				l.strokes[accented] = []Stroke{deadKey, s}
+			}
+		}
+	}
+	return l
+}
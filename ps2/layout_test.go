@@ -0,0 +1,259 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package ps2_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/fzipp/oberon/ps2"
+)
+
+func plain(code byte) ps2.Stroke {
+	return ps2.Stroke{Key: ps2.Key{Code: code}}
+}
+
+func shift(code byte) ps2.Stroke {
+	return ps2.Stroke{Key: ps2.Key{Code: code}, Mods: ps2.Shift}
+}
+
+func altGr(code byte) ps2.Stroke {
+	return ps2.Stroke{Key: ps2.Key{Code: code}, Mods: ps2.AltGraph}
+}
+
+const (
+	keyA     = 0x1C
+	keyE     = 0x24
+	keyI     = 0x43
+	keyN     = 0x31
+	keySpace = 0x29
+	keyEnter = 0x5A
+)
+
+type layoutTest struct {
+	r    rune
+	want []ps2.Stroke // nil if the character can't be typed
+}
+
+func testLayout(t *testing.T, l *ps2.Layout, tests []layoutTest) {
+	t.Helper()
+	for _, tt := range tests {
+		got, ok := l.Strokes(tt.r)
+		if tt.want == nil {
+			if ok {
+				t.Errorf("%s: Strokes(%q) = %v, want none", l.Name, tt.r, got)
+			}
+			continue
+		}
+		if !ok || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Strokes(%q) = %v, %v; want %v", l.Name, tt.r, got, ok, tt.want)
+		}
+	}
+}
+
+func TestLayoutUS(t *testing.T) {
+	testLayout(t, ps2.US, []layoutTest{
+		// Plain
+		{'a', []ps2.Stroke{plain(keyA)}},
+		{'y', []ps2.Stroke{plain(0x35)}},
+		{'z', []ps2.Stroke{plain(0x1A)}},
+		{'1', []ps2.Stroke{plain(0x16)}},
+		{'-', []ps2.Stroke{plain(0x4E)}},
+		{'\\', []ps2.Stroke{plain(0x5D)}},
+		{' ', []ps2.Stroke{plain(keySpace)}},
+		{'\r', []ps2.Stroke{plain(keyEnter)}},
+		{'\n', []ps2.Stroke{plain(keyEnter)}},
+		{'\t', []ps2.Stroke{plain(0x0D)}},
+		// Shift
+		{'A', []ps2.Stroke{shift(keyA)}},
+		{'@', []ps2.Stroke{shift(0x1E)}},
+		{'^', []ps2.Stroke{shift(0x36)}},
+		{'~', []ps2.Stroke{shift(0x0E)}},
+		{'"', []ps2.Stroke{shift(0x52)}},
+		// Can't be typed
+		{'ä', nil},
+		{'ê', nil},
+		{'ß', nil},
+		{'€', nil},
+	})
+}
+
+func TestLayoutGerman(t *testing.T) {
+	testLayout(t, ps2.German, []layoutTest{
+		// Plain
+		{'a', []ps2.Stroke{plain(keyA)}},
+		{'y', []ps2.Stroke{plain(0x1A)}},
+		{'z', []ps2.Stroke{plain(0x35)}},
+		{'ß', []ps2.Stroke{plain(0x4E)}},
+		{'ü', []ps2.Stroke{plain(0x54)}},
+		{'ö', []ps2.Stroke{plain(0x4C)}},
+		{'ä', []ps2.Stroke{plain(0x52)}},
+		{'#', []ps2.Stroke{plain(0x5D)}},
+		{'-', []ps2.Stroke{plain(0x4A)}},
+		{'<', []ps2.Stroke{plain(0x61)}},
+		{'\r', []ps2.Stroke{plain(keyEnter)}},
+		// Shift
+		{'Z', []ps2.Stroke{shift(0x35)}},
+		{'Ä', []ps2.Stroke{shift(0x52)}},
+		{'"', []ps2.Stroke{shift(0x1E)}},
+		{'?', []ps2.Stroke{shift(0x4E)}},
+		{'_', []ps2.Stroke{shift(0x4A)}},
+		// AltGr
+		{'@', []ps2.Stroke{altGr(0x15)}},
+		{'\\', []ps2.Stroke{altGr(0x4E)}},
+		{'{', []ps2.Stroke{altGr(0x3D)}},
+		{'~', []ps2.Stroke{altGr(0x5B)}},
+		{'|', []ps2.Stroke{altGr(0x61)}},
+		// Dead keys
+		{'ê', []ps2.Stroke{plain(0x0E), plain(keyE)}},
+		{'^', []ps2.Stroke{plain(0x0E), plain(keySpace)}},
+		{'é', []ps2.Stroke{plain(0x55), plain(keyE)}},
+		{'è', []ps2.Stroke{shift(0x55), plain(keyE)}},
+		{'à', []ps2.Stroke{shift(0x55), plain(keyA)}},
+		{'`', []ps2.Stroke{shift(0x55), plain(keySpace)}},
+		// Can't be typed
+		{'´', nil}, // not in Oberon's character set
+		{'ë', nil},
+		{'ç', nil},
+		{'ñ', nil},
+		{'€', nil},
+	})
+}
+
+func TestLayoutSwissGerman(t *testing.T) {
+	testLayout(t, ps2.SwissGerman, []layoutTest{
+		// Plain
+		{'a', []ps2.Stroke{plain(keyA)}},
+		{'y', []ps2.Stroke{plain(0x1A)}},
+		{'z', []ps2.Stroke{plain(0x35)}},
+		{'ü', []ps2.Stroke{plain(0x54)}},
+		{'ä', []ps2.Stroke{plain(0x52)}},
+		{'\'', []ps2.Stroke{plain(0x4E)}},
+		{'$', []ps2.Stroke{plain(0x5D)}},
+		// Shift
+		{'è', []ps2.Stroke{shift(0x54)}},
+		{'é', []ps2.Stroke{shift(0x4C)}},
+		{'à', []ps2.Stroke{shift(0x52)}},
+		{'ç', []ps2.Stroke{shift(0x25)}},
+		{'+', []ps2.Stroke{shift(0x16)}},
+		{'!', []ps2.Stroke{shift(0x5B)}},
+		// AltGr
+		{'@', []ps2.Stroke{altGr(0x1E)}},
+		{'#', []ps2.Stroke{altGr(0x26)}},
+		{'\\', []ps2.Stroke{altGr(0x61)}},
+		{'[', []ps2.Stroke{altGr(0x54)}},
+		{'}', []ps2.Stroke{altGr(0x5D)}},
+		// Dead keys
+		{'ê', []ps2.Stroke{plain(0x55), plain(keyE)}},
+		{'^', []ps2.Stroke{plain(0x55), plain(keySpace)}},
+		{'ì', []ps2.Stroke{shift(0x55), plain(keyI)}},
+		{'`', []ps2.Stroke{shift(0x55), plain(keySpace)}},
+		{'ñ', []ps2.Stroke{altGr(0x55), plain(keyN)}},
+		{'~', []ps2.Stroke{altGr(0x55), plain(keySpace)}},
+		{'á', []ps2.Stroke{altGr(0x4E), plain(keyA)}},
+		{'ë', []ps2.Stroke{plain(0x5B), plain(keyE)}},
+		{'Ä', []ps2.Stroke{plain(0x5B), shift(keyA)}},
+		// Can't be typed
+		{'¨', nil}, // not in Oberon's character set
+		{'ß', nil},
+		{'€', nil},
+	})
+}
+
+func TestLayoutEncode(t *testing.T) {
+	tests := []struct {
+		l    *ps2.Layout
+		r    rune
+		want []byte
+	}{
+		{ps2.US, 'a', []byte{0x1C, 0xF0, 0x1C}},
+		{ps2.US, 'A', []byte{0x12, 0x1C, 0xF0, 0x1C, 0xF0, 0x12}},
+		{ps2.German, '@', []byte{0xE0, 0x11, 0x15, 0xF0, 0x15, 0xE0, 0xF0, 0x11}},
+		{ps2.German, 'ê', []byte{0x0E, 0xF0, 0x0E, 0x24, 0xF0, 0x24}},
+		{ps2.German, '^', []byte{0x0E, 0xF0, 0x0E, 0x29, 0xF0, 0x29}},
+		{ps2.SwissGerman, 'Ä', []byte{0x5B, 0xF0, 0x5B, 0x12, 0x1C, 0xF0, 0x1C, 0xF0, 0x12}},
+	}
+	for _, tt := range tests {
+		got, ok := tt.l.Encode(tt.r)
+		if !ok || !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: Encode(%q) = % X, %v; want % X", tt.l.Name, tt.r, got, ok, tt.want)
+		}
+	}
+	if got, ok := ps2.US.Encode('ä'); ok {
+		t.Errorf("us: Encode('ä') = % X, want none", got)
+	}
+}
+
+// A dead key is pressed and released before the key of the base
+// character, with its own modifiers released in between.
+func TestLayoutEncodeDeadKeys(t *testing.T) {
+	tests := []struct {
+		l    *ps2.Layout
+		r    rune
+		want []byte
+	}{
+		{ps2.German, 'é', []byte{0x55, 0xF0, 0x55, 0x24, 0xF0, 0x24}},
+		{ps2.German, 'è', []byte{0x12, 0x55, 0xF0, 0x55, 0xF0, 0x12, 0x24, 0xF0, 0x24}},
+		{ps2.German, 'î', []byte{0x0E, 0xF0, 0x0E, 0x43, 0xF0, 0x43}},
+		{ps2.German, '`', []byte{0x12, 0x55, 0xF0, 0x55, 0xF0, 0x12, 0x29, 0xF0, 0x29}},
+		{ps2.SwissGerman, 'ì', []byte{0x12, 0x55, 0xF0, 0x55, 0xF0, 0x12, 0x43, 0xF0, 0x43}},
+		{ps2.SwissGerman, 'ñ', []byte{0xE0, 0x11, 0x55, 0xF0, 0x55, 0xE0, 0xF0, 0x11, 0x31, 0xF0, 0x31}},
+		{ps2.SwissGerman, 'á', []byte{0xE0, 0x11, 0x4E, 0xF0, 0x4E, 0xE0, 0xF0, 0x11, 0x1C, 0xF0, 0x1C}},
+		{ps2.SwissGerman, 'ë', []byte{0x5B, 0xF0, 0x5B, 0x24, 0xF0, 0x24}},
+		{ps2.SwissGerman, '~', []byte{0xE0, 0x11, 0x55, 0xF0, 0x55, 0xE0, 0xF0, 0x11, 0x29, 0xF0, 0x29}},
+	}
+	for _, tt := range tests {
+		got, ok := tt.l.Encode(tt.r)
+		if !ok || !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: Encode(%q) = % X, %v; want % X", tt.l.Name, tt.r, got, ok, tt.want)
+		}
+	}
+}
+
+func TestLayoutEncodeTextDeadKeys(t *testing.T) {
+	got := ps2.German.EncodeText("Crêpe à")
+	want := [][]byte{
+		{0x12, 0x21, 0xF0, 0x21, 0xF0, 0x12},
+		{0x2D, 0xF0, 0x2D},
+		{0x0E, 0xF0, 0x0E, 0x24, 0xF0, 0x24},
+		{0x4D, 0xF0, 0x4D},
+		{0x24, 0xF0, 0x24},
+		{0x29, 0xF0, 0x29},
+		{0x12, 0x55, 0xF0, 0x55, 0xF0, 0x12, 0x1C, 0xF0, 0x1C},
+	}
+	if !slices.EqualFunc(got, want, bytes.Equal) {
+		t.Errorf("EncodeText: got % X, want % X", got, want)
+	}
+}
+
+func TestLayoutEncodeText(t *testing.T) {
+	got := ps2.German.EncodeText("Zü€\n")
+	want := [][]byte{
+		{0x12, 0x35, 0xF0, 0x35, 0xF0, 0x12},
+		{0x54, 0xF0, 0x54},
+		// '€' is replaced by '?'.
+		{0x12, 0x4E, 0xF0, 0x4E, 0xF0, 0x12},
+		{0x5A, 0xF0, 0x5A},
+	}
+	if !slices.EqualFunc(got, want, bytes.Equal) {
+		t.Errorf("EncodeText: got % X, want % X", got, want)
+	}
+}
+
+func TestLayoutByName(t *testing.T) {
+	for _, l := range ps2.Layouts {
+		got, err := ps2.LayoutByName(l.Name)
+		if err != nil || got != l {
+			t.Errorf("LayoutByName(%q) = %v, %v; want %v", l.Name, got, err, l.Title)
+		}
+	}
+	if got, err := ps2.LayoutByName("DE"); err != nil || got != ps2.German {
+		t.Errorf("LayoutByName(%q) = %v, %v; want German", "DE", got, err)
+	}
+	if _, err := ps2.LayoutByName("fr"); err == nil {
+		t.Errorf("LayoutByName(%q): want error", "fr")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+// Package ps2 encodes key strokes as PS/2 keyboard command sequences
+// (scan code set 2), as the keyboard driver of Oberon reads them.
+// See https://wiki.osdev.org/PS/2_Keyboard for a list of commands.
+//
+// The frontends of the emulator pass the keys pressed on the host
+// keyboard either by their position, or, in character mode, by the
+// characters they type. In character mode a Layout translates each
+// character into the key strokes that type it with a keyboard driver
+// for that layout, including dead keys for accented characters.
+package ps2
+
+// A Key is a key of a PS/2 keyboard, identified by its scancode.
+type Key struct {
+	Code     byte
+	Extended bool // The scancode is prefixed with 0xE0
+	kind     keyKind
+}
+
+// Keys that are pressed together with other keys.
+var (
+	LeftShift = Key{Code: 0x12}
+	AltGr     = Key{Code: 0x11, Extended: true}
+)
+
+// Press returns the make code of the key. Make adds the fake Shift codes
+// that a keyboard sends with some keys.
+func (k Key) Press() []byte {
+	if k.Extended {
+		return []byte{0xE0, k.Code}
+	}
+	return []byte{k.Code}
+}
+
+// Release returns the break code of the key.
+func (k Key) Release() []byte {
+	if k.Extended {
+		return []byte{0xE0, 0xF0, k.Code}
+	}
+	return []byte{0xF0, k.Code}
+}
+
+// Modifiers is a set of modifier keys held while a key is typed.
+type Modifiers uint8
+
+const (
+	Shift Modifiers = 1 << iota
+	AltGraph
+)
+
+// A Stroke is a key typed while holding modifier keys.
+type Stroke struct {
+	Key  Key
+	Mods Modifiers
+}
+
+// Encode returns the command sequence that presses the modifier keys,
+// presses and releases the key, and releases the modifier keys again.
+func (s Stroke) Encode() []byte {
+	var out []byte
+	if s.Mods&Shift != 0 {
+		out = append(out, LeftShift.Press()...)
+	}
+	if s.Mods&AltGraph != 0 {
+		out = append(out, AltGr.Press()...)
+	}
+	out = append(out, s.Key.Press()...)
+	out = append(out, s.Key.Release()...)
+	if s.Mods&AltGraph != 0 {
+		out = append(out, AltGr.Release()...)
+	}
+	if s.Mods&Shift != 0 {
+		out = append(out, LeftShift.Release()...)
+	}
+	return out
+}
@@ -0,0 +1,22 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package ps2
+
+import "github.com/fzipp/oberon/charset"
+
+// EncodeText returns the command sequences that type a text, one for
+// each character. The text is converted to Oberon's character set by
+// charset.Encode first, so line breaks are typed as Enter (CR) and
+// characters outside of Oberon's character set are replaced. Characters
+// that can't be typed with the layout are left out.
+func (l *Layout) EncodeText(text string) [][]byte {
+	var keys [][]byte
+	for _, c := range charset.Encode(text) {
+		if out, ok := l.Encode(charset.Rune(c)); ok {
+			keys = append(keys, out)
+		}
+	}
+	return keys
+}
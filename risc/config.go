@@ -0,0 +1,235 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package risc
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// A Config describes the memory map of the machine.
+//
+// The framebuffer is part of the RAM. The boot ROM is only visible to
+// instruction fetches; data accesses to its address range are handled
+// like accesses to any other unmapped address. The I/O window is
+// 64 bytes long.
+type Config struct {
+	MemSize      int    // RAM size in bytes, including the framebuffer
+	DisplayStart uint32 // Address of the framebuffer
+	ScreenWidth  int    // Framebuffer width in pixels, a multiple of 32
+	ScreenHeight int    // Framebuffer height in pixels
+	ROMStart     uint32 // Address of the boot ROM
+	IOStart      uint32 // Address of the I/O window
+
+	// FPGAExact enables the address decoding of the FPGA board,
+	// which only uses the lower 20 bits of an address. Addresses that
+	// differ only in the top 12 bits alias each other, e.g. 0xFFFFFFC0
+	// and 0x000FFFC0 both address the I/O window. This requires
+	// exactly 1 MiB of RAM.
+	FPGAExact bool
+}
+
+const fpgaAddressMask = 0x000FFFFF
+
+// DefaultConfig returns the default memory map of the emulator,
+// which is compatible with the FPGA system.
+func DefaultConfig() Config {
+	return Config{
+		MemSize:      defaultMemSize,
+		DisplayStart: defaultDisplayStart,
+		ScreenWidth:  FramebufferWidth,
+		ScreenHeight: FramebufferHeight,
+		ROMStart:     defaultROMStart,
+		IOStart:      defaultIOStart,
+	}
+}
+
+// FPGAConfig returns the memory map of the FPGA system with its
+// 20-bit address decoding. Pointer bugs that go unnoticed in the default
+// configuration, because the emulator uses all 32 address bits, behave
+// in this configuration like they do on the board.
+func FPGAConfig() Config {
+	c := DefaultConfig()
+	c.FPGAExact = true
+	return c
+}
+
+// Validate checks that the memory map is consistent.
+func (c Config) Validate() error {
+	if c.ScreenWidth <= 0 || c.ScreenWidth%32 != 0 || c.ScreenHeight <= 0 {
+		return fmt.Errorf("invalid screen size %dx%d", c.ScreenWidth, c.ScreenHeight)
+	}
+	if c.MemSize <= 0 || c.MemSize%4 != 0 {
+		return fmt.Errorf("invalid memory size %d", c.MemSize)
+	}
+	if c.DisplayStart%4 != 0 || c.ROMStart%4 != 0 || c.IOStart%4 != 0 {
+		return errors.New("display, ROM and I/O addresses must be word aligned")
+	}
+	displayEnd := uint64(c.DisplayStart) + uint64(c.ScreenWidth*c.ScreenHeight/8)
+	if displayEnd > uint64(c.MemSize) {
+		return fmt.Errorf("framebuffer at 0x%08X exceeds memory size 0x%X", c.DisplayStart, c.MemSize)
+	}
+	if c.FPGAExact {
+		if c.MemSize != fpgaAddressMask+1 {
+			return errors.New("FPGA address decoding requires 1 MiB of memory")
+		}
+		if displayEnd > uint64(c.IOStart&fpgaAddressMask) {
+			return errors.New("framebuffer overlaps I/O window")
+		}
+		return nil
+	}
+	if uint64(c.MemSize) > uint64(c.ROMStart) || uint64(c.MemSize) > uint64(c.IOStart) {
+		return errors.New("memory overlaps ROM or I/O window")
+	}
+	if c.ROMStart < c.IOStart+64 && c.IOStart < c.ROMStart+romWords*4 {
+		return errors.New("ROM overlaps I/O window")
+	}
+	return nil
+}
+
+// Configure sets the memory map of the machine and resets it.
+// The content of the memory is cleared.
+//
+// If the framebuffer is not at its default address, the memory limit and
+// stack origin constants in the boot loader are patched, and the display
+// driver is informed of the framebuffer layout. This requires a custom
+// Display.Mod.
+func (r *RISC) Configure(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	r.configure(c)
+	r.Reset()
+	return nil
+}
+
+func (r *RISC) configure(c Config) {
+	r.displayStart = c.DisplayStart
+	r.romStart = c.ROMStart
+	r.ioStart = c.IOStart
+	r.addrMask = 0xFFFFFFFF
+	if c.FPGAExact {
+		r.addrMask = fpgaAddressMask
+		r.romStart &= fpgaAddressMask
+		r.ioStart &= fpgaAddressMask
+	}
+
+	r.displayResizes = 0
+
+	columns := c.ScreenWidth / 32
+	r.damage = image.Rect(0, 0, columns-1, c.ScreenHeight-1)
+	r.damageTiles.init(columns, c.ScreenHeight)
+	r.damageTiles.markAll()
+
+	r.Mem = make([]uint32, c.MemSize/4)
+	r.framebuffer = Framebuffer{
+		Rect:    image.Rect(0, 0, c.ScreenWidth, c.ScreenHeight),
+		Pix:     r.Mem[r.displayStart/4:],
+		Palette: r.palette,
+	}
+
+	r.patchROM()
+	if r.displayStart == defaultDisplayStart {
+		return
+	}
+
+	// Inform the display driver of the framebuffer layout.
+	// This isn't a very pretty mechanism, but this way our disk images
+	// should still boot on the standard FPGA system.
+	if r.displayStart >= defaultDisplayStart+16 {
+		r.writeDisplayInfo(defaultDisplayStart)
+	}
+	if r.displayStart >= 16 {
+		r.writeDisplayInfo(r.displayStart - 16)
+	}
+}
+
+// writeDisplayInfo writes the display info block, which describes the
+// framebuffer layout to the display driver, at the given address.
+//
+// The block is written at the default framebuffer address for the driver
+// to find it on startup, and into the 16 bytes between the memory limit
+// of the boot loader and the framebuffer, which Oberon doesn't use. Only
+// the latter is updated when the display is resized, since the memory at
+// the default address may have been reused by then.
+func (r *RISC) writeDisplayInfo(address uint32) {
+	r.Mem[address/4] = displayInfoMagic
+	r.Mem[address/4+1] = uint32(r.framebuffer.Rect.Dx())
+	r.Mem[address/4+2] = uint32(r.framebuffer.Rect.Dy())
+	r.Mem[address/4+3] = r.displayStart
+}
+
+const displayInfoMagic = 0x53697A67 // "Sizg"
+
+// ResizeDisplay changes the size of the framebuffer while the machine is
+// running. The framebuffer memory is reallocated, keeping the content
+// that fits into the new size, anchored at the bottom left like the
+// Oberon display coordinates.
+//
+// Only a display driver that knows about it can follow the change: it is
+// announced by updating the display info block just below the framebuffer
+// (see Configure) and by incrementing the counter that can be read from
+// the I/O address -16. The driver is expected to poll the counter and
+// reread the info block when it changes.
+//
+// Resizing requires a framebuffer that was moved from its default address
+// with Configure or ConfigureMemory, and is not possible with the
+// address decoding of the FPGA board.
+func (r *RISC) ResizeDisplay(width, height int) error {
+	if r.displayStart == defaultDisplayStart || r.displayStart < 16 || r.addrMask != 0xFFFFFFFF {
+		return errors.New("display can't be resized in this memory configuration")
+	}
+	if width <= 0 || width%32 != 0 || height <= 0 {
+		return fmt.Errorf("invalid screen size %dx%d", width, height)
+	}
+	memSize := uint64(r.displayStart) + uint64(width*height/8)
+	if memSize > uint64(r.romStart) || memSize > uint64(r.ioStart) {
+		return fmt.Errorf("screen size %dx%d exceeds address space", width, height)
+	}
+	old := r.framebuffer
+	if width == old.Rect.Dx() && height == old.Rect.Dy() {
+		return nil
+	}
+
+	mem := make([]uint32, memSize/4)
+	copy(mem, r.Mem[:r.displayStart/4])
+	r.Mem = mem
+	r.framebuffer.Rect = image.Rect(0, 0, width, height)
+	r.framebuffer.Pix = r.Mem[r.displayStart/4:]
+
+	oldColumns, columns := old.Rect.Dx()/32, width/32
+	for line := range min(old.Rect.Dy(), height) {
+		copy(r.framebuffer.Pix[line*columns:(line+1)*columns], old.Pix[line*oldColumns:(line+1)*oldColumns])
+	}
+
+	r.damage = image.Rect(0, 0, columns-1, height-1)
+	r.damageTiles.init(columns, height)
+	r.damageTiles.markAll()
+
+	r.writeDisplayInfo(r.displayStart - 16)
+	r.displayResizes++
+	return nil
+}
+
+// patchROM copies the ROM image into the ROM and patches the new
+// constants in the bootloader if the framebuffer was moved.
+func (r *RISC) patchROM() {
+	r.rom = r.romImage
+	if r.displayStart == defaultDisplayStart {
+		return
+	}
+	// MOV' R1, hi; IOR R1, R1, lo; ... MOV' R1, hi
+	if r.rom[372]&0xFFFF0000 != 0x61000000 ||
+		r.rom[373]&0xFFFF0000 != 0x41160000 ||
+		r.rom[376]&0xFFFF0000 != 0x61000000 {
+		return
+	}
+	memLim := r.displayStart - 16
+	r.rom[372] = 0x61000000 + (memLim >> 16)
+	r.rom[373] = 0x41160000 + (memLim & 0x0000FFFF)
+	stackOrg := r.displayStart / 2
+	r.rom[376] = 0x61000000 + (stackOrg >> 16)
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package risc
+
+import "image"
+
+// The framebuffer is divided into tiles of damageTileColumns words
+// (32 pixels each) by damageTileLines lines. Each tile that is written
+// to is marked as damaged, so that writes to distant parts of the screen
+// do not grow into one large rectangle.
+const (
+	damageTileColumns = 4
+	damageTileLines   = 16
+)
+
+type damageTiles struct {
+	columns int // framebuffer width in words
+	lines   int // framebuffer height in lines
+	tilesX  int
+	tilesY  int
+	dirty   []bool
+	any     bool
+}
+
+func (t *damageTiles) init(columns, lines int) {
+	t.columns = columns
+	t.lines = lines
+	t.tilesX = (columns + damageTileColumns - 1) / damageTileColumns
+	t.tilesY = (lines + damageTileLines - 1) / damageTileLines
+	t.dirty = make([]bool, t.tilesX*t.tilesY)
+	t.any = false
+}
+
+func (t *damageTiles) mark(col, row int) {
+	t.dirty[(row/damageTileLines)*t.tilesX+col/damageTileColumns] = true
+	t.any = true
+}
+
+func (t *damageTiles) markAll() {
+	for i := range t.dirty {
+		t.dirty[i] = true
+	}
+	t.any = true
+}
+
+func (t *damageTiles) reset() {
+	if !t.any {
+		return
+	}
+	clear(t.dirty)
+	t.any = false
+}
+
+// rects returns the damaged tiles as rectangles in the same coordinates
+// as GetFramebufferDamageAndReset. Horizontally adjacent tiles are joined
+// into runs, and runs spanning the same columns in consecutive tile rows
+// are joined into a single rectangle.
+func (t *damageTiles) rects() []image.Rectangle {
+	if !t.any {
+		return nil
+	}
+	var rects []image.Rectangle
+	// open maps a run of tile columns to the index of the rectangle
+	// that ended in the previous tile row.
+	open := map[[2]int]int{}
+	for ty := range t.tilesY {
+		next := map[[2]int]int{}
+		row := t.dirty[ty*t.tilesX : (ty+1)*t.tilesX]
+		for tx := 0; tx < t.tilesX; tx++ {
+			if !row[tx] {
+				continue
+			}
+			start := tx
+			for tx+1 < t.tilesX && row[tx+1] {
+				tx++
+			}
+			run := [2]int{start, tx}
+			maxY := min((ty+1)*damageTileLines, t.lines) - 1
+			if i, ok := open[run]; ok {
+				rects[i].Max.Y = maxY
+				next[run] = i
+				continue
+			}
+			next[run] = len(rects)
+			rects = append(rects, image.Rectangle{
+				Min: image.Point{X: start * damageTileColumns, Y: ty * damageTileLines},
+				Max: image.Point{X: min((tx+1)*damageTileColumns, t.columns) - 1, Y: maxY},
+			})
+		}
+		open = next
+	}
+	return rects
+}
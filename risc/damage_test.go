@@ -0,0 +1,177 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package risc
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+// The damage benchmarks replay the framebuffer writes of typical editing
+// sessions, one frame per iteration, and report the bytes per frame that
+// a frontend sends for the damaged regions in each of the update
+// formats of the web frontend:
+//
+//   - full:    32-bit RGBA pixels
+//   - packed:  framebuffer words, one bit per pixel
+//   - deflate: packed words compressed with DEFLATE
+//
+// The metrics with the "bbox-" prefix are the sizes for the single
+// bounding box of GetFramebufferDamageAndReset, as the baseline for the
+// separate damage rectangles.
+
+const (
+	fontLines     = 16                     // lines of a character cell
+	lineBytes     = FramebufferWidth / 8   // bytes of a framebuffer line
+	textLines     = FramebufferHeight / 16 // text lines on the screen
+	viewerColumns = 80                     // characters of a text line in the viewer
+)
+
+// Header sizes of the display update messages of the canvas protocol,
+// see Context.UpdateDisplay in cmd/oberon-emu/internal/canvas: a command
+// byte and the x, y, width and height of the rectangle, followed in the
+// packed updates by the black and white colors and in the compressed
+// update by the length of the data.
+const (
+	fullHeaderSize    = 1 + 4*4
+	packedHeaderSize  = fullHeaderSize + 2*4
+	deflateHeaderSize = packedHeaderSize + 4
+)
+
+// glyph returns the pixels of a character cell, one byte per line.
+func glyph(c byte) [fontLines]byte {
+	var g [fontLines]byte
+	for i := 2; i < fontLines-3; i++ {
+		g[i] = (c*byte(i+7) ^ c>>1) & 0x7E
+	}
+	return g
+}
+
+// drawChar draws a character at a text column and line, with text line
+// 0 at the top of the screen.
+func drawChar(r *RISC, col, line int, c byte) {
+	g := glyph(c)
+	for i, bits := range g {
+		row := FramebufferHeight - 1 - (line*fontLines + i)
+		r.storeByte(r.displayStart+uint32(row*lineBytes+col), bits)
+	}
+}
+
+// sampleText returns the character at a position of the edited text.
+func sampleText(col, line int) byte {
+	const text = "PROCEDURE Write*(VAR W: Writer; ch: CHAR); BEGIN Files.Write(W.rider, ch) END Write; "
+	return text[(line*7+col)%len(text)]
+}
+
+// BenchmarkDamageTyping types one character per frame into a line of
+// a text viewer.
+func BenchmarkDamageTyping(b *testing.B) {
+	benchmarkDamage(b, func(r *RISC, i int) {
+		drawChar(r, i%viewerColumns, 10, sampleText(i, 0))
+	})
+}
+
+// BenchmarkDamageTypingAndLog types one character per frame into a line
+// of a text viewer on the left while a command writes one character per
+// frame to the log viewer in the right track of the screen. The bounding
+// box spans the screen between them.
+func BenchmarkDamageTypingAndLog(b *testing.B) {
+	const logColumn = viewerColumns + 16
+	benchmarkDamage(b, func(r *RISC, i int) {
+		drawChar(r, i%viewerColumns, textLines-10, sampleText(i, 0))
+		drawChar(r, logColumn+i%(lineBytes-logColumn), 2, sampleText(i, 1))
+	})
+}
+
+// BenchmarkDamageScrolling scrolls a text viewer covering the left part
+// of the screen by one line per frame.
+func BenchmarkDamageScrolling(b *testing.B) {
+	benchmarkDamage(b, func(r *RISC, i int) {
+		for line := range textLines {
+			for col := range viewerColumns {
+				drawChar(r, col, line, sampleText(col, line+i))
+			}
+		}
+	})
+}
+
+// BenchmarkDamageSelection inverts a selected line of text per frame,
+// as when dragging a selection over a paragraph.
+func BenchmarkDamageSelection(b *testing.B) {
+	benchmarkDamage(b, func(r *RISC, i int) {
+		line := 5 + i%20
+		for l := range fontLines {
+			row := FramebufferHeight - 1 - (line*fontLines + l)
+			for col := 0; col < viewerColumns; col += 4 {
+				addr := r.displayStart + uint32(row*lineBytes+col)
+				r.storeWord(addr, ^r.loadWord(addr))
+			}
+		}
+	})
+}
+
+func benchmarkDamage(b *testing.B, frame func(r *RISC, i int)) {
+	r := New()
+	fb := r.Framebuffer()
+	var c, bbox updateCounter
+	r.GetFramebufferDamageRectsAndReset()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		frame(r, i)
+		// Both methods reset the damage, so the bounding box is
+		// taken from the field.
+		if d := r.damage; d.Min.Y <= d.Max.Y {
+			bbox.count(fb, d)
+		}
+		for _, d := range r.GetFramebufferDamageRectsAndReset() {
+			c.count(fb, d)
+		}
+	}
+	c.report(b, "")
+	bbox.report(b, "bbox-")
+}
+
+// updateCounter sums up the sizes of the display updates, including the
+// headers of the update messages.
+type updateCounter struct {
+	full, packed, deflate int
+
+	words      []byte
+	compressed bytes.Buffer
+	deflater   *flate.Writer
+}
+
+func (c *updateCounter) count(fb *Framebuffer, d image.Rectangle) {
+	cols := d.Max.X - d.Min.X + 1
+	lines := d.Max.Y - d.Min.Y + 1
+	c.full += fullHeaderSize + cols*32*lines*4
+	c.packed += packedHeaderSize + cols*lines*4
+
+	c.words = c.words[:0]
+	width := fb.Rect.Dx() / 32
+	for line := d.Max.Y; line >= d.Min.Y; line-- {
+		for col := d.Min.X; col <= d.Max.X; col++ {
+			c.words = binary.BigEndian.AppendUint32(c.words, fb.Pix[line*width+col])
+		}
+	}
+	c.compressed.Reset()
+	if c.deflater == nil {
+		c.deflater, _ = flate.NewWriter(&c.compressed, flate.BestSpeed)
+	} else {
+		c.deflater.Reset(&c.compressed)
+	}
+	_, _ = c.deflater.Write(c.words)
+	_ = c.deflater.Close()
+	c.deflate += deflateHeaderSize + c.compressed.Len()
+}
+
+func (c *updateCounter) report(b *testing.B, prefix string) {
+	b.ReportMetric(float64(c.full)/float64(b.N), prefix+"full-B/op")
+	b.ReportMetric(float64(c.packed)/float64(b.N), prefix+"packed-B/op")
+	b.ReportMetric(float64(c.deflate)/float64(b.N), prefix+"deflate-B/op")
+}
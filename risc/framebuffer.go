@@ -9,14 +9,10 @@ import (
 	"image/color"
 )
 
-var (
-	colorBlack = color.RGBA{R: 0x65, G: 0x7b, B: 0x83, A: 0xff}
-	colorWhite = color.RGBA{R: 0xfd, G: 0xf6, B: 0xe3, A: 0xff}
-)
-
 type Framebuffer struct {
-	Rect image.Rectangle
-	Pix  []uint32
+	Rect    image.Rectangle
+	Pix     []uint32
+	Palette Palette // Display colors of the pixel values
 }
 
 func (fb *Framebuffer) ColorModel() color.Model {
@@ -32,10 +28,7 @@ func (fb *Framebuffer) At(x, y int) color.Color {
 		return color.RGBA{}
 	}
 	i, bit := fb.PixOffset(x, y)
-	if (fb.Pix[i]>>bit)&1 == 0 {
-		return colorBlack
-	}
-	return colorWhite
+	return fb.Palette.Color(fb.Pix[i] >> bit)
 }
 
 // PixOffset is a helper method to locate a pixel in the Pix slice.
@@ -46,5 +39,21 @@ func (fb *Framebuffer) At(x, y int) color.Color {
 // The coordinates (x, y) are interpreted as image coordinates with the
 // origin (0, 0) at the top left.
 func (fb *Framebuffer) PixOffset(x, y int) (i, bit int) {
-	return (fb.Rect.Max.Y-y)*(fb.Rect.Max.X/32) + (x / 32), x % 32
+	return (fb.Rect.Max.Y-1-y)*(fb.Rect.Max.X/32) + (x / 32), x % 32
+}
+
+// Snapshot returns a copy of the pixels within r, in image coordinates,
+// as an image with the two colors of the palette. Unlike the framebuffer
+// itself, which shares its pixels with the memory of the running machine,
+// the copy does not change.
+func (fb *Framebuffer) Snapshot(r image.Rectangle) *image.Paletted {
+	r = r.Intersect(fb.Rect)
+	img := image.NewPaletted(r, color.Palette{fb.Palette.Black, fb.Palette.White})
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i, bit := fb.PixOffset(x, y)
+			img.SetColorIndex(x, y, uint8(fb.Pix[i]>>bit&1))
+		}
+	}
+	return img
 }
@@ -0,0 +1,56 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package risc
+
+import (
+	"image"
+	"testing"
+)
+
+func TestFramebufferPixOffset(t *testing.T) {
+	// 64x4 pixels: two words per line, with the bottom line first.
+	fb := &Framebuffer{Rect: image.Rect(0, 0, 64, 4), Pix: make([]uint32, 8)}
+	tests := []struct {
+		x, y   int
+		i, bit int
+	}{
+		{0, 0, 6, 0},
+		{31, 0, 6, 31},
+		{32, 0, 7, 0},
+		{5, 1, 4, 5},
+		{0, 3, 0, 0},
+		{63, 3, 1, 31},
+	}
+	for _, tt := range tests {
+		i, bit := fb.PixOffset(tt.x, tt.y)
+		if i != tt.i || bit != tt.bit {
+			t.Errorf("PixOffset(%d, %d) = %d, %d; want %d, %d", tt.x, tt.y, i, bit, tt.i, tt.bit)
+		}
+	}
+}
+
+func TestFramebufferAt(t *testing.T) {
+	fb := &Framebuffer{
+		Rect:    image.Rect(0, 0, 64, 4),
+		Pix:     make([]uint32, 8),
+		Palette: DefaultPalette,
+	}
+	fb.Pix[6] = 1 << 2  // top line
+	fb.Pix[1] = 1 << 31 // bottom line
+	white := []image.Point{{2, 0}, {63, 3}}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 64; x++ {
+			want := fb.Palette.Black
+			for _, p := range white {
+				if p == image.Pt(x, y) {
+					want = fb.Palette.White
+				}
+			}
+			if got := fb.At(x, y); got != want {
+				t.Errorf("At(%d, %d) = %v; want %v", x, y, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package risc
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// MaxKeyboardInput is the number of keyboard scancodes that can wait
+// for the next instruction batch, see KeyboardInput.
+const MaxKeyboardInput = 256
+
+// ErrKeyboardOverflow is returned by KeyboardInput if the scancodes
+// don't fit into the keyboard buffer.
+var ErrKeyboardOverflow = errors.New("keyboard buffer overflow")
+
+// An inputQueue collects the input from other goroutines until the
+// machine takes it over at the start of an instruction batch.
+type inputQueue struct {
+	mouse atomic.Uint32 // mouse position and buttons, as read from I/O address 24
+	wheel atomic.Int32  // mouse wheel steps
+
+	mu        sync.Mutex
+	keys      []byte // scancodes waiting for the next batch
+	overflows int    // number of rejected KeyboardInput calls
+}
+
+// updateMouse changes the mouse state with f without locking.
+func (q *inputQueue) updateMouse(f func(mouse uint32) uint32) {
+	for {
+		old := q.mouse.Load()
+		if q.mouse.CompareAndSwap(old, f(old)) {
+			return
+		}
+	}
+}
+
+// MouseMoved sets the position of the mouse, with the origin at the
+// bottom left of the display. It may be called from any goroutine.
+func (r *RISC) MouseMoved(x, y int) {
+	r.input.updateMouse(func(mouse uint32) uint32 {
+		if x >= 0 && x <= 0xFFF {
+			mouse = (mouse &^ 0x00000FFF) | uint32(x)
+		}
+		if y >= 0 && y <= 0xFFF {
+			mouse = (mouse &^ 0x00FFF000) | (uint32(y) << 12)
+		}
+		return mouse
+	})
+}
+
+// MouseButton presses or releases mouse button 1 (left), 2 (middle)
+// or 3 (right). It may be called from any goroutine.
+func (r *RISC) MouseButton(button int, down bool) {
+	if button < 1 || button > 3 {
+		return
+	}
+	bit := uint32(1 << (27 - button))
+	r.input.updateMouse(func(mouse uint32) uint32 {
+		if down {
+			return mouse | bit
+		}
+		return mouse &^ bit
+	})
+}
+
+// MouseWheel turns the mouse wheel by the given number of steps,
+// positive for scrolling down, i.e. towards the end of a text. It may
+// be called from any goroutine. The machine reads the sum of the steps
+// since its last read from I/O address -12. The standard Oberon system
+// doesn't read it; the module oberon/Wheel.Mod of this repository
+// scrolls text viewers with it.
+func (r *RISC) MouseWheel(steps int) {
+	r.input.wheel.Add(int32(steps))
+}
+
+// KeyboardInput queues PS/2 keyboard scancodes for the machine. It may
+// be called from any goroutine. The scancodes are passed to the machine
+// at the start of the next instruction batch, see Run. If fewer than
+// len(ps2commands) scancodes fit into the buffer of MaxKeyboardInput
+// scancodes, none of them are queued and ErrKeyboardOverflow is
+// returned, so that no partial key sequences reach the machine.
+func (r *RISC) KeyboardInput(ps2commands []byte) error {
+	q := &r.input
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.keys)+len(ps2commands) > MaxKeyboardInput {
+		q.overflows++
+		return ErrKeyboardOverflow
+	}
+	q.keys = append(q.keys, ps2commands...)
+	return nil
+}
+
+// KeyboardOverflows returns the number of KeyboardInput calls that
+// were rejected because the keyboard buffer was full.
+func (r *RISC) KeyboardOverflows() int {
+	q := &r.input
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.overflows
+}
+
+// takeInput passes the queued input to the machine. The machine buffers
+// at most MaxKeyboardInput scancodes that it hasn't read yet; the rest
+// stays queued.
+func (r *RISC) takeInput() {
+	r.mouse = r.input.mouse.Load()
+	r.wheel += r.input.wheel.Swap(0)
+
+	q := &r.input
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := min(len(q.keys), MaxKeyboardInput-len(r.keyBuf))
+	if n <= 0 {
+		return
+	}
+	r.keyBuf = append(r.keyBuf, q.keys[:n]...)
+	q.keys = append(q.keys[:0], q.keys[n:]...)
+}
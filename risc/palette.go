@@ -0,0 +1,112 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package risc
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Palette holds the colors in which the framebuffer is displayed.
+// Black is the color of pixels with the value 0, which Oberon uses for
+// the background, and White the color of pixels with the value 1, which
+// Oberon uses for text.
+type Palette struct {
+	Black color.RGBA
+	White color.RGBA
+}
+
+// Color returns the color of a pixel with the given value (0 or 1).
+func (p Palette) Color(pixel uint32) color.RGBA {
+	if pixel&1 == 0 {
+		return p.Black
+	}
+	return p.White
+}
+
+// DefaultPalette is the solarized-like color pair used by default.
+var DefaultPalette = Themes["solarized"]
+
+// Themes are the built-in palettes by name.
+var Themes = map[string]Palette{
+	// The current look: light text on a grey background
+	"solarized": {
+		Black: color.RGBA{R: 0x65, G: 0x7b, B: 0x83, A: 0xff},
+		White: color.RGBA{R: 0xfd, G: 0xf6, B: 0xe3, A: 0xff},
+	},
+	// Black text on a white background, like Oberon on the Ceres
+	"classic": {
+		Black: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		White: color.RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xff},
+	},
+	// The solarized colors swapped: grey text on a light background
+	"inverted": {
+		Black: color.RGBA{R: 0xfd, G: 0xf6, B: 0xe3, A: 0xff},
+		White: color.RGBA{R: 0x65, G: 0x7b, B: 0x83, A: 0xff},
+	},
+	// White text on a black background
+	"high-contrast": {
+		Black: color.RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xff},
+		White: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	},
+}
+
+// ThemeNames returns the names of the built-in themes in sorted order.
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParsePalette parses a palette given either as the name of a theme or
+// as two hexadecimal colors "BLACK,WHITE", e.g. "#000000,#ffff00".
+func ParsePalette(s string) (Palette, error) {
+	if p, ok := Themes[s]; ok {
+		return p, nil
+	}
+	black, white, ok := strings.Cut(s, ",")
+	if !ok {
+		return Palette{}, fmt.Errorf("unknown theme %q, use one of %s or BLACK,WHITE colors",
+			s, strings.Join(ThemeNames(), ", "))
+	}
+	var p Palette
+	var err error
+	if p.Black, err = parseColor(black); err != nil {
+		return Palette{}, err
+	}
+	if p.White, err = parseColor(white); err != nil {
+		return Palette{}, err
+	}
+	return p, nil
+}
+
+// parseColor parses a color in the hexadecimal form "#RRGGBB" or "RRGGBB".
+func parseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected #RRGGBB", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected #RRGGBB", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// SetPalette changes the colors of the framebuffer and marks the whole
+// framebuffer as damaged, so that frontends redraw it.
+func (r *RISC) SetPalette(p Palette) {
+	r.palette = p
+	r.framebuffer.Palette = p
+	r.damage = image.Rect(0, 0, r.framebuffer.Rect.Max.X/32-1, r.framebuffer.Rect.Max.Y-1)
+	r.damageTiles.markAll()
+}
@@ -0,0 +1,18 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package risc
+
+// A Profiler is notified of every executed instruction.
+// The PC is the word address of the instruction, i.e. the byte address
+// divided by four.
+type Profiler interface {
+	Count(pc uint32)
+}
+
+// SetProfiler sets a profiler that counts the executed instructions.
+// Setting it to nil disables profiling.
+func (r *RISC) SetProfiler(p Profiler) {
+	r.profiler = p
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package risc
+
+import "fmt"
+
+// An Access is the kind of a memory access that caused an Error.
+type Access int
+
+const (
+	AccessNone  Access = iota // The error was not caused by a memory access
+	AccessRead                // Load instruction
+	AccessWrite               // Store instruction
+)
+
+func (a Access) String() string {
+	switch a {
+	case AccessRead:
+		return "read"
+	case AccessWrite:
+		return "write"
+	}
+	return "none"
+}
+
+// A Region is the address range [Start, End).
+type Region struct {
+	Start uint32
+	End   uint32
+}
+
+// Contains reports whether the address is within the region.
+func (g Region) Contains(address uint32) bool {
+	return g.Start <= address && address < g.End
+}
+
+// SetStrict enables or disables strict memory checking.
+//
+// By default, loads from unmapped addresses return 0, and stores to
+// unmapped addresses are ignored. In strict mode, the following data
+// accesses fail with an *Error that reports the address, the kind of
+// access and the PC of the instruction:
+//   - accesses outside of RAM and the I/O window,
+//   - stores into the address range of the boot ROM,
+//   - accesses to a guard region, see SetGuardRegions.
+func (r *RISC) SetStrict(strict bool) {
+	r.strict = strict
+}
+
+// SetGuardRegions sets address ranges that must not be accessed by load
+// or store instructions, e.g. the first bytes of memory to detect NIL
+// pointer dereferences. Instruction fetches are not checked. Guard regions
+// are only checked in strict mode, see SetStrict.
+//
+// Note that the Oberon system itself uses the words at the addresses
+// 0 to 24 to hand over values from the boot loader.
+func (r *RISC) SetGuardRegions(regions []Region) {
+	r.guards = regions
+}
+
+// checkAccess reports whether a data access to the address is valid
+// in strict mode. If it is not, the fault is recorded and reported at the
+// end of the current instruction.
+func (r *RISC) checkAccess(address uint32, access Access) bool {
+	var reason string
+	for _, g := range r.guards {
+		if g.Contains(address) {
+			reason = "guard region"
+			break
+		}
+	}
+	if reason == "" {
+		switch {
+		case address < uint32(r.memSize()) && address < r.ioStart:
+			return true
+		case address >= r.ioStart && address-r.ioStart < 64:
+			return true
+		case access == AccessWrite && address >= r.romStart && address-r.romStart < romWords*4:
+			reason = "ROM"
+		default:
+			reason = "unmapped address"
+		}
+	}
+	if r.fault == nil {
+		r.fault = &Error{
+			PC:      r.PC - 1,
+			Address: address,
+			Access:  access,
+			message: fmt.Sprintf("invalid %s access to %s at 0x%08X", access, reason, address),
+		}
+	}
+	return false
+}
@@ -25,6 +25,9 @@ const (
 // FPGA system. But If the user requests more memory, we move the
 // framebuffer to make room for a larger Oberon heap. This requires a
 // custom Display.Mod.
+//
+// The FPGA address decoding can be enabled with Config.FPGAExact to
+// catch pointer bugs that only show up on the board.
 
 const (
 	defaultMemSize      = 0x00100000 // 1 MiB
@@ -32,9 +35,9 @@ const (
 )
 
 const (
-	romStart = 0xFFFFF800
-	romWords = 512
-	ioStart  = 0xFFFFFFC0
+	defaultROMStart = 0xFFFFF800
+	defaultIOStart  = 0xFFFFFFC0
+	romWords        = 512
 )
 
 type RISC struct {
@@ -47,11 +50,16 @@ type RISC struct {
 	V  bool       // Overflow flag
 
 	displayStart uint32
+	romStart     uint32
+	ioStart      uint32
+	addrMask     uint32
 
 	progress           uint32
 	millisecondCounter uint32
-	mouse              uint32
-	keyBuf             []byte
+	mouse              uint32 // mouse state of the current instruction batch
+	keyBuf             []byte // scancodes not yet read by the machine
+	wheel              int32  // mouse wheel steps not yet read by the machine
+	input              inputQueue
 	switches           uint32
 
 	leds        LED
@@ -60,11 +68,21 @@ type RISC struct {
 	spi         [4]SPI
 	clipboard   Clipboard
 
-	framebuffer Framebuffer
-	damage      image.Rectangle
+	profiler Profiler
+
+	strict bool
+	guards []Region
+	fault  *Error
+
+	framebuffer    Framebuffer
+	palette        Palette
+	displayResizes uint32
+	damage         image.Rectangle
+	damageTiles    damageTiles
 
-	Mem []uint32 // Memory
-	rom [romWords]uint32
+	Mem      []uint32 // Memory
+	rom      [romWords]uint32
+	romImage [romWords]uint32
 }
 
 // RISC instructions set
@@ -92,52 +110,23 @@ const (
 )
 
 func New() *RISC {
-	screenWidth := FramebufferWidth
-	screenHeight := FramebufferHeight
-	r := &RISC{
-		displayStart: defaultDisplayStart,
-	}
-	columns := screenWidth / 32
-	r.damage = image.Rect(0, 0, columns-1, screenHeight-1)
-	r.Mem = make([]uint32, defaultMemSize/4)
-	r.framebuffer = Framebuffer{
-		Rect: image.Rect(0, 0, screenWidth, screenHeight),
-		Pix:  r.Mem[r.displayStart/4:],
-	}
-	r.rom = bootloader
+	r := &RISC{romImage: bootloader, palette: DefaultPalette}
+	r.configure(DefaultConfig())
 	r.Reset()
 	return r
 }
 
+// ConfigureMemory moves the framebuffer behind the given amount of RAM,
+// which is clamped to between 1 and 32 megabytes, and sets the
+// framebuffer size. See Configure.
 func (r *RISC) ConfigureMemory(megabytesRAM, screenWidth, screenHeight int) {
 	megabytesRAM = clamp(megabytesRAM, 1, 32)
-
-	r.displayStart = uint32(megabytesRAM << 20)
-	columns := screenWidth / 32
-	r.damage = image.Rect(0, 0, columns-1, screenHeight-1)
-
-	memSize := r.displayStart + uint32((screenWidth*screenHeight)/8)
-	r.Mem = make([]uint32, memSize/4)
-	r.framebuffer = Framebuffer{
-		Rect: image.Rect(0, 0, screenWidth, screenHeight),
-		Pix:  r.Mem[r.displayStart/4:],
-	}
-
-	// Patch the new constants in the bootloader.
-	memLim := r.displayStart - 16
-	r.rom[372] = 0x61000000 + (memLim >> 16)
-	r.rom[373] = 0x41160000 + (memLim & 0x0000FFFF)
-	stackOrg := r.displayStart / 2
-	r.rom[376] = 0x61000000 + (stackOrg >> 16)
-
-	// Inform the display driver of the framebuffer layout.
-	// This isn't a very pretty mechanism, but this way our disk images
-	// should still boot on the standard FPGA system.
-	r.Mem[defaultDisplayStart/4] = 0x53697A67
-	r.Mem[defaultDisplayStart/4+1] = uint32(screenWidth)
-	r.Mem[defaultDisplayStart/4+2] = uint32(screenHeight)
-	r.Mem[defaultDisplayStart/4+3] = r.displayStart
-
+	c := DefaultConfig()
+	c.DisplayStart = uint32(megabytesRAM << 20)
+	c.ScreenWidth = screenWidth
+	c.ScreenHeight = screenHeight
+	c.MemSize = int(c.DisplayStart) + (screenWidth*screenHeight)/8
+	r.configure(c)
 	r.Reset()
 }
 
@@ -164,10 +153,15 @@ func (r *RISC) SetSwitches(s int) {
 }
 
 func (r *RISC) Reset() {
-	r.PC = romStart / 4
+	r.PC = r.romStart / 4
 }
 
+// Run executes a batch of instructions for the given number of cycles,
+// or until the machine waits for input or for the millisecond counter.
+// The input queued since the last batch is passed to the machine at the
+// start of the batch.
 func (r *RISC) Run(cycles int) error {
+	r.takeInput()
 	r.progress = 20
 	// The progress value is used to detect that the RISC cpu is busy
 	// waiting on the millisecond counter or on the keyboard ready
@@ -185,13 +179,17 @@ func (r *RISC) Run(cycles int) error {
 
 func (r *RISC) singleStep() error {
 	var IR uint32 // Instruction register
-	if r.PC < uint32(len(r.Mem)) {
+	r.PC &= r.addrMask / 4
+	if r.PC >= r.romStart/4 && r.PC < r.romStart/4+romWords {
+		IR = r.rom[r.PC-r.romStart/4]
+	} else if r.PC < uint32(len(r.Mem)) {
 		IR = r.Mem[r.PC]
-	} else if r.PC >= romStart/4 && r.PC < romStart/4+romWords {
-		IR = r.rom[r.PC-romStart/4]
 	} else {
 		return &Error{PC: r.PC, message: "branched into the void"}
 	}
+	if r.profiler != nil {
+		r.profiler.Count(r.PC)
+	}
 	r.PC++
 
 	const (
@@ -357,6 +355,11 @@ func (r *RISC) singleStep() error {
 				r.storeByte(address, byte(Ra))
 			}
 		}
+		if r.fault != nil {
+			err := r.fault
+			r.fault = nil
+			return err
+		}
 	} else {
 		// Branch instructions (format F3)
 		// TODO: interrupts?
@@ -409,7 +412,11 @@ func (r *RISC) setRegister(reg uint32, value uint32) {
 }
 
 func (r *RISC) loadWord(address uint32) uint32 {
-	if address < uint32(r.memSize()) {
+	address &= r.addrMask
+	if r.strict && !r.checkAccess(address, AccessRead) {
+		return 0
+	}
+	if address < uint32(r.memSize()) && address < r.ioStart {
 		return r.Mem[address/4]
 	}
 	return r.loadIO(address)
@@ -427,6 +434,7 @@ func (r *RISC) updateDamage(word int) {
 		return
 	}
 	col := word % columns
+	r.damageTiles.mark(col, row)
 	if col < r.damage.Min.X {
 		r.damage.Min.X = col
 	}
@@ -442,9 +450,13 @@ func (r *RISC) updateDamage(word int) {
 }
 
 func (r *RISC) storeWord(address, value uint32) {
+	address &= r.addrMask
+	if r.strict && !r.checkAccess(address, AccessWrite) {
+		return
+	}
 	if address < r.displayStart {
 		r.Mem[address/4] = value
-	} else if address < uint32(r.memSize()) {
+	} else if address < uint32(r.memSize()) && address < r.ioStart {
 		r.Mem[address/4] = value
 		r.updateDamage(int(address/4 - r.displayStart/4))
 	} else {
@@ -453,7 +465,11 @@ func (r *RISC) storeWord(address, value uint32) {
 }
 
 func (r *RISC) storeByte(address uint32, value byte) {
-	if address < uint32(r.memSize()) {
+	address &= r.addrMask
+	if r.strict && !r.checkAccess(address, AccessWrite) {
+		return
+	}
+	if address < uint32(r.memSize()) && address < r.ioStart {
 		w := r.loadWord(address)
 		shift := (address & 3) * 8
 		w &= ^(0xFF << shift)
@@ -465,7 +481,7 @@ func (r *RISC) storeByte(address uint32, value byte) {
 }
 
 func (r *RISC) loadIO(address uint32) uint32 {
-	switch address - ioStart {
+	switch address - r.ioStart {
 	case 0:
 		// Millisecond counter
 		r.progress--
@@ -526,13 +542,21 @@ func (r *RISC) loadIO(address uint32) uint32 {
 			return 0
 		}
 		return r.clipboard.ReadData()
+	case 48:
+		// Display resize counter
+		return r.displayResizes
+	case 52:
+		// Mouse wheel steps since the last read
+		steps := r.wheel
+		r.wheel = 0
+		return uint32(steps)
 	default:
 		return 0
 	}
 }
 
 func (r *RISC) storeIO(address, value uint32) {
-	switch address - ioStart {
+	switch address - r.ioStart {
 	case 4:
 		// LEDs
 		if r.leds != nil {
@@ -573,31 +597,6 @@ func (r *RISC) SetTime(millis uint32) {
 	r.millisecondCounter = millis
 }
 
-func (r *RISC) MouseMoved(x, y int) {
-	if x >= 0 && x <= 0xFFF {
-		r.mouse = (r.mouse &^ 0x00000FFF) | uint32(x)
-	}
-	if y >= 0 && y <= 0xFFF {
-		r.mouse = (r.mouse &^ 0x00FFF000) | (uint32(y) << 12)
-	}
-}
-
-func (r *RISC) MouseButton(button int, down bool) {
-	if button < 1 || button > 3 {
-		return
-	}
-	bit := uint32(1 << (27 - button))
-	if down {
-		r.mouse = r.mouse | bit
-	} else {
-		r.mouse = r.mouse &^ bit
-	}
-}
-
-func (r *RISC) KeyboardInput(ps2commands []byte) {
-	r.keyBuf = append(r.keyBuf, ps2commands...)
-}
-
 func (r *RISC) Framebuffer() *Framebuffer {
 	return &r.framebuffer
 }
@@ -608,7 +607,19 @@ func (r *RISC) GetFramebufferDamageAndReset() image.Rectangle {
 	return d
 }
 
+// GetFramebufferDamageRectsAndReset returns the damaged regions of the
+// framebuffer since the last reset as a list of rectangles, in the same
+// coordinates as GetFramebufferDamageAndReset. Unlike the single bounding
+// box, writes to distant parts of the screen are reported separately.
+// The list is empty if nothing was damaged.
+func (r *RISC) GetFramebufferDamageRectsAndReset() []image.Rectangle {
+	rects := r.damageTiles.rects()
+	r.resetFramebufferDamage()
+	return rects
+}
+
 func (r *RISC) resetFramebufferDamage() {
+	r.damageTiles.reset()
 	r.damage = image.Rectangle{
 		Min: image.Point{X: r.framebuffer.Rect.Max.X / 32, Y: r.framebuffer.Rect.Max.Y},
 		Max: image.Point{},
@@ -637,8 +648,11 @@ func clamp(x, min, max int) int {
 	return x
 }
 
+// An Error is a fatal condition that stops the execution of a program.
 type Error struct {
-	PC      uint32
+	PC      uint32 // Word address of the instruction
+	Address uint32 // Address of the memory access, if Access is not AccessNone
+	Access  Access // Kind of the memory access that caused the error
 	message string
 }
 
@@ -0,0 +1,271 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package risc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ROMSize is the maximum size of a boot ROM image in words.
+const ROMSize = romWords
+
+// A ROMFormat is a file format for boot ROM images.
+type ROMFormat int
+
+const (
+	ROMRaw      ROMFormat = iota // Binary, 32-bit little-endian words
+	ROMIntelHex                  // Intel HEX, bytes of little-endian words
+	ROMMem                       // Hexadecimal words for Verilog's $readmemh, e.g. prom.mem
+)
+
+// ROMFormatFor determines the format of a boot ROM image file by its
+// file name extension: ".hex" for Intel HEX, ".mem" for $readmemh,
+// anything else for raw binary.
+func ROMFormatFor(filename string) ROMFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".hex", ".ihex":
+		return ROMIntelHex
+	case ".mem":
+		return ROMMem
+	}
+	return ROMRaw
+}
+
+// LoadROM reads a boot ROM image from a file. The format is determined
+// by the file name extension, see ROMFormatFor.
+func LoadROM(filename string) ([]uint32, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("can't open ROM image: %w", err)
+	}
+	defer f.Close()
+	words, err := ReadROM(f, ROMFormatFor(filename))
+	if err != nil {
+		return nil, fmt.Errorf("can't read ROM image %q: %w", filename, err)
+	}
+	return words, nil
+}
+
+// ReadROM reads a boot ROM image in the given format.
+// The image must not be empty and not be larger than ROMSize words.
+func ReadROM(r io.Reader, format ROMFormat) ([]uint32, error) {
+	var words []uint32
+	var err error
+	switch format {
+	case ROMRaw:
+		words, err = readROMRaw(r)
+	case ROMIntelHex:
+		words, err = readROMIntelHex(r)
+	case ROMMem:
+		words, err = readROMMem(r)
+	default:
+		return nil, fmt.Errorf("unknown ROM format %d", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, errors.New("empty ROM image")
+	}
+	if len(words) > ROMSize {
+		return nil, fmt.Errorf("ROM image has %d words, maximum is %d", len(words), ROMSize)
+	}
+	return words, nil
+}
+
+func readROMRaw(r io.Reader) ([]uint32, error) {
+	data, err := io.ReadAll(io.LimitReader(r, ROMSize*4+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > ROMSize*4 {
+		return nil, fmt.Errorf("ROM image has more than %d words", ROMSize)
+	}
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("size %d is not a multiple of 4 bytes", len(data))
+	}
+	words := make([]uint32, len(data)/4)
+	err = binary.Read(bytes.NewReader(data), binary.LittleEndian, words)
+	return words, err
+}
+
+func readROMIntelHex(r io.Reader) ([]uint32, error) {
+	type chunk struct {
+		addr uint32
+		data []byte
+	}
+	var chunks []chunk
+	var base uint32
+	minAddr := ^uint32(0)
+	s := bufio.NewScanner(r)
+	eof := false
+	for line := 1; !eof && s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" {
+			continue
+		}
+		if text[0] != ':' || len(text) < 11 || len(text)%2 != 1 {
+			return nil, fmt.Errorf("line %d: invalid record", line)
+		}
+		rec := make([]byte, (len(text)-1)/2)
+		for i := range rec {
+			b, err := strconv.ParseUint(text[1+2*i:3+2*i], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid hex digits", line)
+			}
+			rec[i] = byte(b)
+		}
+		n := int(rec[0])
+		if len(rec) != n+5 {
+			return nil, fmt.Errorf("line %d: wrong record length", line)
+		}
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("line %d: checksum mismatch", line)
+		}
+		addr := uint32(rec[1])<<8 | uint32(rec[2])
+		data := rec[4 : 4+n]
+		switch rec[3] {
+		case 0x00: // data
+			a := base + addr
+			minAddr = min(minAddr, a)
+			chunks = append(chunks, chunk{addr: a, data: data})
+		case 0x01: // end of file
+			eof = true
+		case 0x02: // extended segment address
+			if n != 2 {
+				return nil, fmt.Errorf("line %d: invalid segment address", line)
+			}
+			base = (uint32(data[0])<<8 | uint32(data[1])) << 4
+		case 0x04: // extended linear address
+			if n != 2 {
+				return nil, fmt.Errorf("line %d: invalid linear address", line)
+			}
+			base = (uint32(data[0])<<8 | uint32(data[1])) << 16
+		case 0x03, 0x05: // start address, not needed
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type %02X", line, rec[3])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	// Addresses are offsets into the ROM, unless the image was
+	// located at an absolute address, e.g. 0xFFFFF800.
+	origin := uint32(0)
+	if minAddr >= ROMSize*4 {
+		origin = minAddr
+	}
+	var image []byte
+	for _, c := range chunks {
+		offset := c.addr - origin
+		if offset+uint32(len(c.data)) > ROMSize*4 {
+			return nil, fmt.Errorf("data at address 0x%08X is outside of the ROM", c.addr)
+		}
+		end := int(offset) + len(c.data)
+		if end > len(image) {
+			image = append(image, make([]byte, end-len(image))...)
+		}
+		copy(image[offset:], c.data)
+	}
+	for len(image)%4 != 0 {
+		image = append(image, 0)
+	}
+	return readROMRaw(bytes.NewReader(image))
+}
+
+func readROMMem(r io.Reader) ([]uint32, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := stripVerilogComments(string(data))
+	var words []uint32
+	addr := 0
+	for _, field := range strings.Fields(text) {
+		if strings.HasPrefix(field, "@") {
+			a, err := strconv.ParseUint(field[1:], 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", field)
+			}
+			if a >= ROMSize {
+				return nil, fmt.Errorf("address %q is outside of the ROM", field)
+			}
+			addr = int(a)
+			continue
+		}
+		w, err := strconv.ParseUint(strings.ReplaceAll(field, "_", ""), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid word %q", field)
+		}
+		if addr >= ROMSize {
+			return nil, fmt.Errorf("ROM image has more than %d words", ROMSize)
+		}
+		if addr >= len(words) {
+			words = append(words, make([]uint32, addr+1-len(words))...)
+		}
+		words[addr] = uint32(w)
+		addr++
+	}
+	return words, nil
+}
+
+func stripVerilogComments(s string) string {
+	var sb strings.Builder
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, "//"):
+			end := strings.IndexByte(s, '\n')
+			if end < 0 {
+				end = len(s)
+			}
+			s = s[end:]
+		case strings.HasPrefix(s, "/*"):
+			end := strings.Index(s[2:], "*/")
+			if end < 0 {
+				return sb.String()
+			}
+			s = s[2+end+2:]
+			sb.WriteByte(' ')
+		default:
+			sb.WriteByte(s[0])
+			s = s[1:]
+		}
+	}
+	return sb.String()
+}
+
+// SetROM replaces the boot ROM with the given image, which is padded
+// with zeros to ROMSize words. The ROM is replaced at once: a machine
+// that is executing the old boot loader continues in the new image, so
+// the ROM should be set before the machine runs, or followed by Reset.
+// The constants of the standard boot loader that depend on the memory
+// configuration are only patched if the image contains the instructions
+// that load them at the same positions.
+func (r *RISC) SetROM(words []uint32) error {
+	if len(words) > ROMSize {
+		return fmt.Errorf("ROM image has %d words, maximum is %d", len(words), ROMSize)
+	}
+	r.romImage = [romWords]uint32{}
+	copy(r.romImage[:], words)
+	r.patchROM()
+	return nil
+}
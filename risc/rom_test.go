@@ -0,0 +1,200 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package risc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// ihex returns an Intel HEX record with a correct checksum.
+func ihex(typ byte, addr uint16, data ...byte) string {
+	rec := append([]byte{byte(len(data)), byte(addr >> 8), byte(addr), typ}, data...)
+	var sum byte
+	for _, b := range rec {
+		sum += b
+	}
+	return fmt.Sprintf(":%X%02X\n", rec, -sum)
+}
+
+var ihexEOF = ihex(0x01, 0)
+
+// repeatWords returns n words counting up from 1.
+func repeatWords(n int) []uint32 {
+	words := make([]uint32, n)
+	for i := range words {
+		words[i] = uint32(i + 1)
+	}
+	return words
+}
+
+func rawImage(words []uint32) string {
+	var sb strings.Builder
+	for _, w := range words {
+		sb.Write([]byte{byte(w), byte(w >> 8), byte(w >> 16), byte(w >> 24)})
+	}
+	return sb.String()
+}
+
+func TestReadROM(t *testing.T) {
+	tests := []struct {
+		name   string
+		format ROMFormat
+		input  string
+		want   []uint32
+	}{
+		{"raw", ROMRaw, "\x01\x00\x00\xE7\x78\x56\x34\x12", []uint32{0xE7000001, 0x12345678}},
+		{"raw of maximum size", ROMRaw, rawImage(repeatWords(ROMSize)), repeatWords(ROMSize)},
+
+		{"hex", ROMIntelHex,
+			ihex(0x00, 0, 0x01, 0x00, 0x00, 0xE7, 0x78, 0x56, 0x34, 0x12) + ihexEOF,
+			[]uint32{0xE7000001, 0x12345678}},
+		{"hex in lower case with CRLF", ROMIntelHex,
+			strings.ToLower(strings.ReplaceAll(ihex(0x00, 0, 1, 2, 3, 4)+ihexEOF, "\n", "\r\n")),
+			[]uint32{0x04030201}},
+		{"hex with gaps and records out of order", ROMIntelHex,
+			ihex(0x00, 8, 0x03) + ihex(0x00, 0, 0x01) + ihexEOF,
+			[]uint32{0x00000001, 0, 0x00000003}},
+		{"hex with an odd number of bytes", ROMIntelHex,
+			ihex(0x00, 0, 0x01, 0x02, 0x03, 0x04, 0x05) + ihexEOF,
+			[]uint32{0x04030201, 0x00000005}},
+		{"hex at an absolute address", ROMIntelHex,
+			ihex(0x04, 0, 0xFF, 0xFF) + ihex(0x00, 0xF800, 1, 0, 0, 0) + ihex(0x00, 0xF804, 2, 0, 0, 0) + ihexEOF,
+			[]uint32{1, 2}},
+		{"hex with a segment address", ROMIntelHex,
+			ihex(0x02, 0, 0x00, 0x01) + ihex(0x00, 0, 0xAA) + ihex(0x00, 0x10, 0xBB) + ihexEOF,
+			[]uint32{0, 0, 0, 0, 0x000000AA, 0, 0, 0, 0x000000BB}},
+		{"hex with a start address", ROMIntelHex,
+			ihex(0x00, 0, 1, 0, 0, 0) + ihex(0x05, 0, 0xFF, 0xFF, 0xF8, 0x00) + ihexEOF,
+			[]uint32{1}},
+		{"hex ignores records after the end", ROMIntelHex,
+			ihex(0x00, 0, 1, 0, 0, 0) + ihexEOF + "garbage\n",
+			[]uint32{1}},
+
+		{"mem", ROMMem, "E7000001\n12345678\n", []uint32{0xE7000001, 0x12345678}},
+		{"mem with comments and underscores", ROMMem,
+			"// boot loader\n4EE9_0014 /* SUB SP, SP, 20 */ AFE00000 // STW LNK, SP, 0",
+			[]uint32{0x4EE90014, 0xAFE00000}},
+		{"mem with addresses", ROMMem, "@2 3 4\n@0 1", []uint32{1, 0, 3, 4}},
+		{"mem of maximum size", ROMMem, fmt.Sprintf("@%X 7", ROMSize-1), append(make([]uint32, ROMSize-1), 7)},
+	}
+	for _, tt := range tests {
+		got, err := ReadROM(strings.NewReader(tt.input), tt.format)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %X, want %X", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadROMErrors(t *testing.T) {
+	badChecksum := ihex(0x00, 0, 1, 2, 3, 4)
+	badChecksum = badChecksum[:len(badChecksum)-3] + "00\n"
+	tests := []struct {
+		name   string
+		format ROMFormat
+		input  string
+		want   string
+	}{
+		{"empty raw", ROMRaw, "", "empty ROM image"},
+		{"raw of odd length", ROMRaw, "\x01\x02\x03\x04\x05\x06", "size 6 is not a multiple of 4 bytes"},
+		{"oversized raw", ROMRaw, rawImage(repeatWords(ROMSize + 1)), "ROM image has more than 512 words"},
+
+		{"empty hex", ROMIntelHex, ihexEOF, "empty ROM image"},
+		{"hex with bad checksum", ROMIntelHex, ihex(0x00, 0, 0) + badChecksum, "line 2: checksum mismatch"},
+		{"hex without colon", ROMIntelHex, "0400000001020304F2\n", "line 1: invalid record"},
+		{"hex too short", ROMIntelHex, ":00000001\n", "line 1: invalid record"},
+		{"hex of odd length", ROMIntelHex, ":0400000001020304F\n", "line 1: invalid record"},
+		{"hex with invalid digits", ROMIntelHex, ":04000000010203XXF2\n", "line 1: invalid hex digits"},
+		{"hex with wrong length", ROMIntelHex, ":0500000001020304F1\n", "line 1: wrong record length"},
+		{"hex with unknown record type", ROMIntelHex, ihex(0x06, 0), "line 1: unknown record type 06"},
+		{"hex with invalid linear address", ROMIntelHex, ihex(0x04, 0, 0xFF), "line 1: invalid linear address"},
+		{"hex with invalid segment address", ROMIntelHex, ihex(0x02, 0, 0xFF), "line 1: invalid segment address"},
+		{"oversized hex", ROMIntelHex,
+			ihex(0x00, 0, 1, 0, 0, 0) + ihex(0x00, ROMSize*4, 1) + ihexEOF,
+			"data at address 0x00000800 is outside of the ROM"},
+		{"hex crossing the end of the ROM", ROMIntelHex,
+			ihex(0x00, ROMSize*4-2, 1, 2, 3, 4) + ihexEOF,
+			"data at address 0x000007FE is outside of the ROM"},
+
+		{"empty mem", ROMMem, "// nothing\n", "empty ROM image"},
+		{"mem with invalid word", ROMMem, "E7000001 xyz", `invalid word "xyz"`},
+		{"mem with too large word", ROMMem, "100000000", `invalid word "100000000"`},
+		{"mem with invalid address", ROMMem, "@x 1", `invalid address "@x"`},
+		{"mem with address outside of the ROM", ROMMem, "@200 1", `address "@200" is outside of the ROM`},
+		{"oversized mem", ROMMem, strings.Repeat("0 ", ROMSize+1), "ROM image has more than 512 words"},
+
+		{"unknown format", ROMFormat(99), "", "unknown ROM format 99"},
+	}
+	for _, tt := range tests {
+		got, err := ReadROM(strings.NewReader(tt.input), tt.format)
+		if err == nil {
+			t.Errorf("%s: got %X, want error %q", tt.name, got, tt.want)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("%s: got error %q, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestROMFormatFor(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     ROMFormat
+	}{
+		{"boot.rom", ROMRaw},
+		{"boot.bin", ROMRaw},
+		{"boot", ROMRaw},
+		{"boot.hex", ROMIntelHex},
+		{"BOOT.HEX", ROMIntelHex},
+		{"boot.ihex", ROMIntelHex},
+		{"prom.mem", ROMMem},
+		{"dir.hex/boot.rom", ROMRaw},
+	}
+	for _, tt := range tests {
+		if got := ROMFormatFor(tt.filename); got != tt.want {
+			t.Errorf("ROMFormatFor(%q) = %d, want %d", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestLoadROM(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "prom.mem")
+	if err := os.WriteFile(filename, []byte("E7000001\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadROM(filename)
+	if err != nil {
+		t.Fatalf("LoadROM: unexpected error: %v", err)
+	}
+	if want := []uint32{0xE7000001}; !slices.Equal(got, want) {
+		t.Errorf("LoadROM: got %X, want %X", got, want)
+	}
+	if _, err := LoadROM(filepath.Join(dir, "missing.rom")); err == nil {
+		t.Error("LoadROM of a missing file: want error")
+	}
+}
+
+func TestSetROM(t *testing.T) {
+	r := New()
+	if err := r.SetROM([]uint32{1, 2}); err != nil {
+		t.Fatalf("SetROM: unexpected error: %v", err)
+	}
+	if r.rom[0] != 1 || r.rom[1] != 2 || r.rom[2] != 0 {
+		t.Errorf("ROM starts with %X, want 1 2 0", r.rom[:3])
+	}
+	if err := r.SetROM(make([]uint32, ROMSize+1)); err == nil {
+		t.Error("SetROM of an oversized image: want error")
+	}
+}
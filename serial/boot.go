@@ -0,0 +1,44 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package serial
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// bootBlockSize is the maximum number of bytes per block of a boot stream.
+const bootBlockSize = 1024
+
+// WriteBootStream encodes a boot image in the format that the boot loader
+// in the ROM expects when it loads the system over the serial line
+// (BootLoad.LoadFromLine), and writes it to w.
+//
+// The image is a memory image starting at address 0, like the boot file
+// of the inner core produced by ORL.Link. It is padded with zeros to a
+// multiple of four bytes. The stream consists of blocks, each starting
+// with its length in bytes and its destination address, followed by the
+// data words. A block with length 0 ends the stream. All numbers are
+// 32-bit little-endian integers.
+func WriteBootStream(w io.Writer, image []byte) error {
+	bw := bufio.NewWriter(w)
+	putInt := func(x uint32) {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], x)
+		_, _ = bw.Write(buf[:])
+	}
+	for len(image)%4 != 0 {
+		image = append(image, 0)
+	}
+	for adr := 0; adr < len(image); adr += bootBlockSize {
+		block := image[adr:min(adr+bootBlockSize, len(image))]
+		putInt(uint32(len(block)))
+		putInt(uint32(adr))
+		_, _ = bw.Write(block)
+	}
+	putInt(0)
+	return bw.Flush()
+}
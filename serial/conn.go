@@ -0,0 +1,79 @@
+// Copyright 2021 Frederik Zipp and others; see NOTICE file.
+// Use of this source code is governed by the ISC license that
+// can be found in the LICENSE file.
+
+package serial
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+// Conn is a serial line connected to a network socket.
+// Unlike Raw, it doesn't block the machine when no data is available:
+// incoming data is received in the background and buffered.
+type Conn struct {
+	conn net.Conn
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Dial connects a serial line to the network address,
+// e.g. Dial("tcp", "localhost:2323").
+func Dial(network, address string) (*Conn, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect serial line: %w", err)
+	}
+	c := &Conn{conn: conn}
+	go c.receive()
+	return c, nil
+}
+
+func (c *Conn) receive() {
+	var buf [512]byte
+	for {
+		n, err := c.conn.Read(buf[:])
+		c.mu.Lock()
+		c.buf = append(c.buf, buf[:n]...)
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *Conn) ReadStatus() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.buf) > 0 {
+		return 3
+	}
+	return 2
+}
+
+func (c *Conn) ReadData() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.buf) == 0 {
+		return 0
+	}
+	b := c.buf[0]
+	c.buf = c.buf[1:]
+	return uint32(b)
+}
+
+func (c *Conn) WriteData(value uint32) {
+	buf := [1]byte{byte(value)}
+	_, err := c.conn.Write(buf[:])
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "can't write serial data: %s\n", err)
+	}
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}